@@ -2,28 +2,28 @@ package main
 
 import (
 	"log"
-	"tommynurwantoro/gontainer"
-	"tommynurwantoro/gontainer/example/obj"
-)
 
-var appContainer gontainer.Container
+	"github.com/tommynurwantoro/gontainer"
+	"github.com/tommynurwantoro/gontainer/_example/obj"
+)
 
 func main() {
+	appContainer := gontainer.New()
+
 	// Register services
 	appContainer.RegisterService("sampleObject1", new(obj.SampleObject1))
+	appContainer.RegisterService("sampleObject2", new(obj.SampleObject2))
 
-	// Start up services
-	if err := appContainer.Ready(); err != nil {
-		log.Panic("Failed to populate service", err)
-	}
+	// Start up services, panicking if any of them fails
+	gontainer.MustReady(appContainer)
 
 	// Get registered object from container
 	obj1 := appContainer.GetServiceOrNil("sampleObject1").(*obj.SampleObject1)
-	obj1.Hello()
+	log.Println(obj1.Hello())
 
-	// Initialize objects with dependencies
-	obj2 := &obj.SampleObject2{}
-	obj2.Object.Hello()
+	// Dependencies are injected into registered objects
+	obj2 := appContainer.GetServiceOrNil("sampleObject2").(*obj.SampleObject2)
+	log.Println(obj2.Object.Hello())
 
 	appContainer.Shutdown()
 }
@@ -1,7 +1,7 @@
 package obj
 
 type SampleObject2 struct {
-	Object SampleObject1 `inject:"sampleObject1"`
+	Object *SampleObject1 `inject:"sampleObject1"`
 }
 
 func (s *SampleObject2) Startup() error {
@@ -1,9 +1,19 @@
 package gontainer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/tommynurwantoro/gontainer/inject"
 )
@@ -11,113 +21,2236 @@ import (
 type Graph interface {
 	Provide(objects ...*inject.Object) error
 	Populate() error
+	PopulateAll() []error
+	Objects() []*inject.Object
 }
 
+// Service is implemented by services with both a startup and a teardown.
 type Service interface {
+	Starter
+	Stopper
+}
+
+// Starter is implemented by services that need starting up. Ready starts
+// them in startup order.
+type Starter interface {
 	Startup() error
+}
+
+// Stopper is implemented by services that need tearing down when the
+// container shuts down.
+type Stopper interface {
 	Shutdown() error
 }
 
+// ContextStarter is implemented by services whose startup takes a context.
+// When present it is preferred over Starter.Startup. The context carries the
+// container, see FromContext.
+type ContextStarter interface {
+	StartupContext(ctx context.Context) error
+}
+
+// ContextStopper is implemented by services whose teardown honors a
+// context. When present it is preferred over Stopper.Shutdown.
+type ContextStopper interface {
+	ShutdownContext(ctx context.Context) error
+}
+
+// Logger is the logger given to services through WithLogger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+	// With returns a child logger for the service with the given id.
+	With(id string) Logger
+}
+
+// NewLogger returns a Logger writing to l, whose child loggers prefix each
+// message with the service id in brackets.
+func NewLogger(l *log.Logger) Logger {
+	return &stdLogger{logger: l}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+	prefix string
+}
+
+func (l *stdLogger) Printf(format string, v ...interface{}) {
+	l.logger.Printf(l.prefix+format, v...)
+}
+
+func (l *stdLogger) With(id string) Logger {
+	return &stdLogger{logger: l.logger, prefix: l.prefix + "[" + id + "] "}
+}
+
+// Clock tells the time. Fields of type Clock tagged `inject:""` get the
+// container's clock, the real one unless replaced with WithClock, so that
+// tests can control the time services see.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Configurable is implemented by services that need a configuration step
+// once the whole graph is wired. Ready calls Configure on every implementer,
+// in startup order, before it starts any service.
+type Configurable interface {
+	Configure() error
+}
+
+// HealthChecker is implemented by services that can report their health.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// ServiceInfo describes a registered service and its wiring.
+type ServiceInfo struct {
+	ID                      string
+	TypeName                string
+	Dependencies            []string // Names of named dependencies, types of unnamed ones
+	ImplementsService       bool
+	ImplementsHealthChecker bool
+	Started                 bool              // Whether the service's startup succeeded and it was not shut down since
+	Tags                    map[string]string // The metadata of the service's object, see inject.Object
+}
+
+// Progress reports a service starting during ReadyWithProgress. Index counts
+// from 1 up to Total, the number of services Ready starts.
+type Progress struct {
+	ID    string
+	Index int
+	Total int
+	Phase string // "starting", "started" or "failed"
+}
+
+// LifecycleEvent is an entry of the transcript returned by Transcript: the
+// startup or teardown of a service, and its outcome.
+type LifecycleEvent struct {
+	Phase     string // "startup" or "shutdown"
+	ID        string
+	StartedAt time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// maxTranscript bounds the number of events a container keeps, dropping the
+// oldest first.
+const maxTranscript = 1024
+
 type Container interface {
 	Ready() error
+	ReadyWithProgress(ch chan<- Progress) error
+	ReadyOnce() error
+	Reset()
+	Reload(ids ...string) error
+	WaitFor(ctx context.Context, id string) error
+	ValidateAll() error
 	GetServiceOrNil(id string) interface{}
+	GetByType(t reflect.Type) (interface{}, error)
 	RegisterService(id string, svc interface{})
+	RegisterServiceObj(id string, svc interface{}) (*inject.Object, error)
+	RegisterProvider(id string, fn interface{})
+	RegisterServiceInGroup(id, group string, svc interface{})
+	RegisterServiceWithPriority(id string, priority int, svc interface{})
+	RegisterServiceCritical(id string, critical bool, svc interface{})
+	ReplaceService(id string, svc interface{}) error
+	MarkComplete(id string) error
+	RegisterServiceIf(id string, svc interface{}, cond func() bool)
+	RegisterAll(services map[string]interface{}) error
+	DependsOn(id string, depIDs ...string)
+	BindInterface(ifacePtr interface{}, implID string)
+	ProvideValue(value interface{})
+	Import(g *inject.Graph) error
+	IDs() []string
+	Snapshot() map[string]interface{}
+	Group(name string) []interface{}
+	Describe() []ServiceInfo
+	Transcript() []LifecycleEvent
+	Health(ctx context.Context) map[string]error
+	Scope() Container
 	Shutdown()
+	Wait()
 }
 
 type container struct {
-	mu       sync.RWMutex
+	// lifecycle serializes Ready and Shutdown. Services are started and
+	// stopped while holding only this lock, so their hooks may call back into
+	// the container.
+	lifecycle sync.Mutex
+
+	mu       sync.RWMutex // Guards the fields below
 	graph    Graph
 	order    []string
 	ready    bool
-	services map[string]interface{}
+	services map[string]*inject.Object // The provided objects, keyed by id
+	groups   map[string][]string       // Service ids in registration order, keyed by group
+	started  map[string]bool           // Ids of services whose startup succeeded
+	up       map[string]bool           // Ids of services Shutdown tears down
+	prepared map[string]bool           // Ids of services whose Configure succeeded
+	stopped  chan struct{}             // Closed when Shutdown completes
+	disabled map[string]bool           // Ids of services whose registration condition was false
+	parent   *container                // The container a scope was created from
+	priority map[string]int            // Startup priorities of services registered with one
+	once     *readyResult              // The result cached by ReadyOnce, nil until it is first called
+	snapshot *inject.Object            // The map of services provided under ServicesID
+	requires map[string][]string       // Startup dependencies declared with DependsOn, keyed by id
+	optional map[string]bool           // Ids of services registered as non-critical
+	provider map[string]reflect.Value  // Functions of services registered with RegisterProvider, keyed by id
+	signals  map[string]*startSignal   // Startup outcomes awaited by WaitFor, keyed by id
+	events   []LifecycleEvent          // The transcript, oldest first
+
+	shutdownTimeout time.Duration
+	startupAttempts int
+	startupBackoff  time.Duration
+	strictUnused    bool
+	postReadyPolicy PostReadyPolicy
+	healthTimeout   time.Duration
+	healthTimeouts  map[string]time.Duration // Per service overrides of healthTimeout
+	maxHealth       int                      // Maximum number of concurrent health checks
+	maxShutdown     int                      // Maximum number of concurrent teardowns, zero for sequential
+	watchdog        time.Duration
+	onStuck         func(id string)
+	onStarted       func(id string)
+	onStopped       func(id string)
+	onReady         func() error
+	propagatePanics bool
+	clock           Clock
+}
+
+// PostReadyPolicy decides what RegisterService does once the container is
+// ready.
+type PostReadyPolicy int
+
+const (
+	// PostReadyError rejects the registration by panicking with
+	// ErrRegisteredAfterReady. This is the default.
+	PostReadyError PostReadyPolicy = iota
+	// PostReadyAllow logs a warning and registers the service. It is wired
+	// and started by the next call to Ready.
+	PostReadyAllow
+	// PostReadyAutoStart registers the service and immediately wires and
+	// starts it.
+	PostReadyAutoStart
+)
+
+// ErrRegisteredAfterReady is the cause of the panic raised when registering a
+// service after the container is ready under the PostReadyError policy.
+var ErrRegisteredAfterReady = errors.New("container is already ready")
+
+// ServiceNotFoundError is the cause of the panic raised by GetServiceOrNil
+// for an id that is not registered, so that callers recovering it can tell
+// which service was missing.
+type ServiceNotFoundError struct {
+	ID string
+}
+
+func (e *ServiceNotFoundError) Error() string {
+	return fmt.Sprintf("service %s not found", e.ID)
+}
+
+// Option configures a container created by New or NewWithGraph. Options are
+// applied in order, so a later option overrides an earlier one setting the
+// same thing. A container created without options starts each service once,
+// waits indefinitely for teardowns and health checks, and rejects services
+// registered once it is ready.
+type Option func(*container)
+
+// WithShutdownTimeout bounds how long Shutdown waits for each service's
+// teardown. A service exceeding it is logged as timed out and Shutdown moves
+// on to the next service. Zero, the default, waits indefinitely.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(c *container) {
+		c.shutdownTimeout = d
+	}
+}
+
+// WithStartupRetry makes Ready try a failing service's Startup up to attempts
+// times, waiting backoff before the first retry and doubling it after each
+// subsequent failure. Errors wrapped with Permanent are never retried.
+func WithStartupRetry(attempts int, backoff time.Duration) Option {
+	return func(c *container) {
+		c.startupAttempts = attempts
+		c.startupBackoff = backoff
+	}
+}
+
+// WithStartupWatchdog calls onStuck with the service's id when its startup
+// has been running for longer than d. The startup is not cancelled and Ready
+// keeps waiting for it, so this is meant for alerting on slow boots rather
+// than as a timeout. onStuck is called from its own goroutine.
+func WithStartupWatchdog(d time.Duration, onStuck func(id string)) Option {
+	return func(c *container) {
+		c.watchdog = d
+		c.onStuck = onStuck
+	}
+}
+
+// WithOnServiceStarted sets a function called with the id of each service
+// after its startup succeeds, in startup order.
+func WithOnServiceStarted(fn func(id string)) Option {
+	return func(c *container) {
+		c.onStarted = fn
+	}
+}
+
+// WithOnReady sets a function called by Ready once every service has
+// started, before it returns. If the function fails, Ready fails and shuts
+// down the services it started. Scopes don't inherit it.
+func WithOnReady(fn func() error) Option {
+	return func(c *container) {
+		c.onReady = fn
+	}
+}
+
+// WithOnServiceStopped sets a function called with the id of each service
+// after its teardown succeeds, in shutdown order.
+func WithOnServiceStopped(fn func(id string)) Option {
+	return func(c *container) {
+		c.onStopped = fn
+	}
+}
+
+// WithRecoverPanics controls whether a panic in a service's startup or
+// shutdown is recovered and reported as an error naming the service, which is
+// the default. Passing false lets such panics propagate.
+func WithRecoverPanics(enabled bool) Option {
+	return func(c *container) {
+		c.propagatePanics = !enabled
+	}
+}
+
+// WithStrictUnused makes Ready fail when a registered service is neither
+// injected anywhere nor participates in the lifecycle, which usually points
+// to a wiring mistake.
+func WithStrictUnused() Option {
+	return func(c *container) {
+		c.strictUnused = true
+	}
+}
+
+// WithPostReadyRegistration sets the policy applied to services registered
+// after the container is ready.
+func WithPostReadyRegistration(policy PostReadyPolicy) Option {
+	return func(c *container) {
+		c.postReadyPolicy = policy
+	}
+}
+
+// WithHealthTimeout bounds how long Health waits for each service's health
+// check. A check exceeding it is reported as context.DeadlineExceeded. Zero,
+// the default, waits as long as the context passed to Health allows.
+func WithHealthTimeout(d time.Duration) Option {
+	return func(c *container) {
+		c.healthTimeout = d
+	}
+}
+
+// WithServiceHealthTimeout overrides the health timeout for the service with
+// the given id.
+func WithServiceHealthTimeout(id string, d time.Duration) Option {
+	return func(c *container) {
+		if c.healthTimeouts == nil {
+			c.healthTimeouts = make(map[string]time.Duration)
+		}
+		c.healthTimeouts[id] = d
+	}
+}
+
+// WithMaxParallelHealth caps how many health checks Health runs at once.
+// Zero, the default, runs all of them concurrently.
+func WithMaxParallelHealth(n int) Option {
+	return func(c *container) {
+		c.maxHealth = n
+	}
+}
+
+// WithMaxParallelShutdown makes Shutdown tear down services by dependency
+// level, starting with the services nothing depends on, running up to n
+// teardowns of a level at once, so the WithOnServiceStopped callback may be
+// called concurrently. Errors within a level are logged joined. Zero, the
+// default, shuts services down one by one in reverse startup order.
+func WithMaxParallelShutdown(n int) Option {
+	return func(c *container) {
+		c.maxShutdown = n
+	}
+}
+
+// WithConstructor registers the constructor used to build t whenever the
+// graph creates a dependency of that pointer type, instead of allocating a
+// zero value. It only applies to containers backed by an *inject.Graph.
+func WithConstructor(t reflect.Type, fn func() interface{}) Option {
+	return func(c *container) {
+		if g, ok := c.graph.(*inject.Graph); ok {
+			if g.Constructors == nil {
+				g.Constructors = make(map[reflect.Type]func() interface{})
+			}
+			g.Constructors[t] = fn
+		}
+	}
+}
+
+// WithValues provides the values injected into fields tagged with
+// `inject:"value:key"`. It only applies to containers backed by an
+// *inject.Graph.
+func WithValues(values map[string]interface{}) Option {
+	return func(c *container) {
+		if g, ok := c.graph.(*inject.Graph); ok {
+			g.Values = values
+		}
+	}
+}
+
+// WithFieldNames fills fields tagged `inject:""` with the service registered
+// under the field's name, when its type fits, before resolving them by type.
+// It only applies to containers backed by an *inject.Graph.
+func WithFieldNames() Option {
+	return func(c *container) {
+		if g, ok := c.graph.(*inject.Graph); ok {
+			g.NameByField = true
+		}
+	}
+}
+
+// WithLogger injects fields of type Logger tagged `inject:""` with a child
+// logger for the service owning them, made with With and the service id.
+// Objects the graph creates get l itself. It only applies to containers backed
+// by an *inject.Graph.
+func WithLogger(l Logger) Option {
+	loggerType := reflect.TypeOf((*Logger)(nil)).Elem()
+	return func(c *container) {
+		if g, ok := c.graph.(*inject.Graph); ok {
+			g.ObjectResolvers = append(g.ObjectResolvers,
+				func(o *inject.Object, field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error) {
+					if fieldType != loggerType || !unnamedInject(field) {
+						return reflect.Value{}, false, nil
+					}
+					if o.Name == "" {
+						return reflect.ValueOf(l), true, nil
+					}
+					return reflect.ValueOf(l.With(o.Name)), true, nil
+				})
+		}
+	}
+}
+
+// unnamedInject reports whether field is tagged `inject:""`, possibly with
+// options, rather than with the name of the object to inject.
+func unnamedInject(field reflect.StructField) bool {
+	name, _, _ := strings.Cut(field.Tag.Get("inject"), ",")
+	return name == ""
+}
+
+// WithClock replaces the real clock injected into fields of type Clock. It
+// only applies to containers backed by an *inject.Graph.
+func WithClock(clock Clock) Option {
+	return func(c *container) {
+		c.clock = clock
+	}
+}
+
+func New(opts ...Option) Container {
+	return NewWithGraph(new(inject.Graph), opts...)
 }
 
-func New() Container {
-	return &container{
-		graph:    new(inject.Graph),
-		order:    make([]string, 0, 16),            // Pre-allocate with capacity hint
-		services: make(map[string]interface{}, 16), // Pre-allocate with capacity hint
+// NewWithGraph creates a container backed by the given graph, for example an
+// inject.Graph configured with a logger or resolvers.
+func NewWithGraph(g Graph, opts ...Option) Container {
+	c := &container{
+		graph:    g,
+		order:    make([]string, 0, 16),               // Pre-allocate with capacity hint
+		services: make(map[string]*inject.Object, 16), // Pre-allocate with capacity hint
+		started:  make(map[string]bool, 16),           // Pre-allocate with capacity hint
+		up:       make(map[string]bool, 16),           // Pre-allocate with capacity hint
+		stopped:  make(chan struct{}),
 		ready:    false,
+		clock:    realClock{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if g, ok := c.graph.(*inject.Graph); ok {
+		// Lazy providers resolve their dependency under the container's
+		// lock, as the container reads the graph under it.
+		if g.Locker == nil {
+			g.Locker = &c.mu
+		}
+		clockType := reflect.TypeOf((*Clock)(nil)).Elem()
+		g.ObjectResolvers = append(g.ObjectResolvers,
+			func(o *inject.Object, field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error) {
+				if fieldType != clockType || !unnamedInject(field) {
+					return reflect.Value{}, false, nil
+				}
+				return reflect.ValueOf(c.clock), true, nil
+			})
 	}
+	return c
 }
 
 // Ready starts up the service graph and returns error if it's not ready
 func (c *container) Ready() error {
-	c.mu.RLock()
+	return c.readyWithProgress(nil)
+}
+
+// ReadyWithProgress is Ready, sending a Progress on ch as each service starts
+// and closing ch when it returns. Sends never block: progress a slow
+// consumer has no room for in ch is dropped. A nil ch behaves like Ready.
+func (c *container) ReadyWithProgress(ch chan<- Progress) error {
+	if ch != nil {
+		defer close(ch)
+	}
+	return c.readyWithProgress(ch)
+}
+
+// readyResult is the outcome of the one Ready call made by ReadyOnce.
+type readyResult struct {
+	once sync.Once
+	err  error
+}
+
+// ReadyOnce calls Ready the first time it is called and returns that call's
+// result from then on, without starting anything again. A failed ReadyOnce is
+// terminal: call Reset to retry.
+func (c *container) ReadyOnce() error {
+	c.mu.Lock()
+	if c.once == nil {
+		c.once = &readyResult{}
+	}
+	result := c.once
+	c.mu.Unlock()
+
+	result.once.Do(func() { result.err = c.Ready() })
+	return result.err
+}
+
+// Reset forgets the result cached by ReadyOnce, so that its next call runs
+// Ready again. It neither starts nor stops services.
+func (c *container) Reset() {
+	c.mu.Lock()
+	c.once = nil
+	c.mu.Unlock()
+}
+
+func (c *container) readyWithProgress(progress chan<- Progress) (err error) {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+	defer func() {
+		if _, degraded := err.(*DegradedError); err != nil && !degraded {
+			c.mu.Lock()
+			c.abortSignals(err)
+			c.mu.Unlock()
+		}
+	}()
+
+	c.mu.Lock()
 	if c.ready {
-		c.mu.RUnlock()
+		c.mu.Unlock()
 		return nil
 	}
+	if err := c.provideServices(); err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("failed to populate graph: %w", err)
+	}
+	if err := c.callProviders(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := c.graph.Populate(); err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("failed to populate graph: %w", err)
+	}
+	if c.strictUnused {
+		if unused := c.unusedServices(); len(unused) > 0 {
+			c.mu.Unlock()
+			return fmt.Errorf("unused services: %s", strings.Join(unused, ", "))
+		}
+	}
+	if err := c.checkDependsOn(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	objects := c.startupOrder()
+	c.mu.Unlock()
+
+	ctx := context.WithValue(context.Background(), containerKey{}, Container(c))
+	var pending []*inject.Object
+	var starts []func() error
+	c.mu.RLock()
+	for _, obj := range objects {
+		if c.started[obj.Name] {
+			continue
+		}
+		if start := startFunc(ctx, obj.Value); start != nil {
+			starts = append(starts, start)
+			pending = append(pending, obj)
+		}
+	}
 	c.mu.RUnlock()
 
+	// Every service is configured before the first one starts.
+	for _, obj := range objects {
+		c.mu.RLock()
+		skip := c.started[obj.Name] || c.prepared[obj.Name]
+		c.mu.RUnlock()
+		configurable, ok := obj.Value.(Configurable)
+		if skip || !ok {
+			continue
+		}
+
+		if err := c.recovered(obj.Name, "configure", configurable.Configure)(); err != nil {
+			return fmt.Errorf("failed to configure service %s: %w", obj.Name, err)
+		}
+		c.mu.Lock()
+		if c.prepared == nil {
+			c.prepared = make(map[string]bool)
+		}
+		c.prepared[obj.Name] = true
+		c.mu.Unlock()
+	}
+
+	// Services without a startup are up once configured, so that Shutdown
+	// still tears them down.
+	var startedNow []*inject.Object
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	for _, obj := range objects {
+		if !c.up[obj.Name] && startFunc(ctx, obj.Value) == nil {
+			c.up[obj.Name] = true
+			startedNow = append(startedNow, obj)
+		}
+	}
+	c.mu.Unlock()
 
-	// Double-check after acquiring write lock
-	if c.ready {
-		return nil
+	var failures map[string]error
+	for i, obj := range pending {
+		report := func(phase string) {
+			if progress == nil {
+				return
+			}
+			select {
+			case progress <- Progress{ID: obj.Name, Index: i + 1, Total: len(pending), Phase: phase}:
+			default:
+			}
+		}
+
+		log.Println("[starting up] ", obj.Name)
+		report("starting")
+		if err := c.watchStartup(obj.Name, c.recovered(obj.Name, "startup", starts[i])); err != nil {
+			report("failed")
+			c.mu.Lock()
+			c.signalStarted(obj.Name, err)
+			optional := c.optional[obj.Name]
+			c.mu.Unlock()
+			if optional {
+				log.Printf("ERROR: [starting up] %s: continuing without non-critical service: %v", obj.Name, err)
+				if failures == nil {
+					failures = make(map[string]error)
+				}
+				failures[obj.Name] = err
+				continue
+			}
+			c.rollback(startedNow)
+			return fmt.Errorf("failed to start service %s: %w", obj.Name, err)
+		}
+		report("started")
+		startedNow = append(startedNow, obj)
+
+		// A started service is complete, so populating the graph again for
+		// late registrations leaves its fields alone.
+		c.mu.Lock()
+		c.started[obj.Name] = true
+		c.up[obj.Name] = true
+		c.signalStarted(obj.Name, nil)
+		obj.Complete = true
+		c.mu.Unlock()
+
+		if c.onStarted != nil {
+			c.onStarted(obj.Name)
+		}
+	}
+
+	if c.onReady != nil {
+		if err := c.onReady(); err != nil {
+			c.rollback(startedNow)
+			return fmt.Errorf("ready hook failed: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.ready = true
+	select {
+	case <-c.stopped:
+		// Restarted after a shutdown, so wait for the next one.
+		c.stopped = make(chan struct{})
+	default:
+	}
+	c.mu.Unlock()
+
+	if failures != nil {
+		return &DegradedError{Failures: failures}
+	}
+	return nil
+}
+
+// startFunc returns the startup hook of service, or nil if it has none.
+func startFunc(ctx context.Context, service interface{}) func() error {
+	switch s := service.(type) {
+	case ContextStarter:
+		return func() error { return s.StartupContext(ctx) }
+	case Starter:
+		return s.Startup
+	}
+	return nil
+}
+
+// Reload restarts the services ids along with the services depending on
+// them, directly or not, while the rest of the container keeps running. The
+// affected services are shut down in reverse startup order, those registered
+// with RegisterProvider are built again by their provider, the graph is
+// populated again so that dependents are wired to the new instances, and the
+// services are configured and started again in startup order.
+func (c *container) Reload(ids ...string) error {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+
+	c.mu.Lock()
+	if !c.ready {
+		c.mu.Unlock()
+		return errors.New("failed to reload services: container is not ready")
+	}
+	for _, id := range ids {
+		if c.services[id] == nil {
+			c.mu.Unlock()
+			return fmt.Errorf("failed to reload service %s: service not found", id)
+		}
+	}
+	objects := c.reloadSet(ids)
+	c.mu.Unlock()
+
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := objects[i]
+		c.mu.RLock()
+		up := c.up[obj.Name]
+		c.mu.RUnlock()
+		if !up {
+			continue
+		}
+		if err := c.shutdownService(obj.Name, obj.Value); err != nil {
+			log.Printf("ERROR: [reloading] %s: %v", obj.Name, err)
+		}
 	}
 
+	c.mu.Lock()
+	for _, obj := range objects {
+		delete(c.started, obj.Name)
+		delete(c.up, obj.Name)
+		delete(c.prepared, obj.Name)
+		delete(c.signals, obj.Name)
+		obj.Complete = false
+	}
+	// callProvider releases c.mu while the provider runs, so that it may
+	// call back into the container.
+	for _, obj := range objects {
+		if fn, ok := c.provider[obj.Name]; ok {
+			if _, err := c.callProvider(obj.Name, fn); err != nil {
+				c.mu.Unlock()
+				return fmt.Errorf("failed to reload service %s: %w", obj.Name, err)
+			}
+		}
+	}
 	if err := c.graph.Populate(); err != nil {
+		c.mu.Unlock()
 		return fmt.Errorf("failed to populate graph: %w", err)
 	}
-	for _, key := range c.order {
-		obj := c.services[key]
-		if s, ok := obj.(Service); ok {
-			log.Println("[starting up] ", key)
-			if err := s.Startup(); err != nil {
-				return fmt.Errorf("failed to start service %s: %w", key, err)
+	c.mu.Unlock()
+
+	ctx := context.WithValue(context.Background(), containerKey{}, Container(c))
+	for _, obj := range objects {
+		if configurable, ok := obj.Value.(Configurable); ok {
+			if err := c.recovered(obj.Name, "configure", configurable.Configure)(); err != nil {
+				return fmt.Errorf("failed to configure service %s: %w", obj.Name, err)
 			}
 		}
 	}
-	c.ready = true
+	for _, obj := range objects {
+		start := startFunc(ctx, obj.Value)
+		if start == nil {
+			c.mu.Lock()
+			c.up[obj.Name] = true
+			c.mu.Unlock()
+			continue
+		}
+		log.Println("[reloading] ", obj.Name)
+		if err := c.watchStartup(obj.Name, c.recovered(obj.Name, "startup", start)); err != nil {
+			c.mu.Lock()
+			c.signalStarted(obj.Name, err)
+			c.mu.Unlock()
+			return fmt.Errorf("failed to start service %s: %w", obj.Name, err)
+		}
+
+		c.mu.Lock()
+		c.started[obj.Name] = true
+		c.up[obj.Name] = true
+		c.signalStarted(obj.Name, nil)
+		obj.Complete = true
+		c.mu.Unlock()
+
+		if c.onStarted != nil {
+			c.onStarted(obj.Name)
+		}
+	}
 	return nil
 }
 
-func (c *container) RegisterService(id string, svc interface{}) {
+// startSignal is closed once the startup of a service completes, with err
+// set if it failed.
+type startSignal struct {
+	done chan struct{}
+	err  error
+}
+
+// WaitFor blocks until the startup of the service id completes, for example
+// from a goroutine of another service that needs it running. It returns nil
+// at once if the service is started or has no startup, the error of its last
+// startup if that failed or of the Ready that failed before starting it, or
+// ctx's error if ctx is done first.
+func (c *container) WaitFor(ctx context.Context, id string) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	obj := c.services[id]
+	if obj == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("failed to wait for service %s: service not found", id)
+	}
+	if c.started[id] || startFunc(ctx, obj.Value) == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	signal := c.signals[id]
+	if signal == nil {
+		signal = c.startSignal(id)
+	}
+	c.mu.Unlock()
 
-	if c.ready {
-		log.Printf("warning: registering service %s after container is ready", id)
+	select {
+	case <-signal.done:
+		if signal.err != nil {
+			return fmt.Errorf("failed to wait for service %s: %w", id, signal.err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	err := c.graph.Provide(&inject.Object{Name: id, Value: svc, Complete: false})
-	if err != nil {
-		// Return error instead of panicking - but we can't change the interface
-		// So we'll log and panic for backward compatibility, but with better error message
-		log.Printf("error providing service %s: %v", id, err)
-		panic(fmt.Errorf("failed to register service %s: %w", id, err))
+// startSignal returns the signal of the next startup of the service id. The
+// caller must hold c.mu.
+func (c *container) startSignal(id string) *startSignal {
+	signal := c.signals[id]
+	if signal != nil {
+		select {
+		case <-signal.done:
+			// That startup is over, so wait for the next one.
+		default:
+			return signal
+		}
 	}
-	c.order = append(c.order, id)
-	c.services[id] = svc
+	signal = &startSignal{done: make(chan struct{})}
+	if c.signals == nil {
+		c.signals = make(map[string]*startSignal)
+	}
+	c.signals[id] = signal
+	return signal
 }
 
-func (c *container) GetServiceOrNil(id string) interface{} {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// signalStarted wakes up those waiting for the startup of the service id,
+// which failed if err is set. The caller must hold c.mu.
+func (c *container) signalStarted(id string, err error) {
+	signal := c.startSignal(id)
+	signal.err = err
+	close(signal.done)
+}
 
-	svc, ok := c.services[id]
-	if !ok {
-		panic(fmt.Errorf("service %s not found", id))
+// abortSignals completes the startup of the services a failed Ready did not
+// start with its error, so that WaitFor returns it rather than blocking until
+// the next Ready. The caller must hold c.mu.
+func (c *container) abortSignals(err error) {
+	for _, id := range c.order {
+		if c.started[id] {
+			continue
+		}
+		if signal := c.signals[id]; signal != nil {
+			select {
+			case <-signal.done:
+				// Its own startup failed, so keep that error.
+				continue
+			default:
+			}
+		}
+		c.signalStarted(id, err)
 	}
-	return svc
 }
 
-func (c *container) Shutdown() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// reloadSet returns, in startup order, the services ids and the services
+// depending on them. The caller must hold c.mu.
+func (c *container) reloadSet(ids []string) []*inject.Object {
+	order := c.startupOrder()
+	index := make(map[*inject.Object]int, len(order))
+	for i, obj := range order {
+		index[obj] = i
+	}
 
-	for _, key := range c.order {
-		if service, ok := c.services[key]; ok {
-			if s, ok := service.(Service); ok {
-				log.Println("[shutting down] ", key)
-				if err := s.Shutdown(); err != nil {
-					log.Printf("ERROR: [shutting down] %s: %v", key, err)
+	reload := make([]bool, len(order))
+	for _, id := range ids {
+		reload[index[c.services[id]]] = true
+	}
+	// Dependencies in a cycle start after their dependents, so repeat until
+	// nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for i, obj := range order {
+			if reload[i] {
+				continue
+			}
+			for _, dep := range c.startupDependencies(obj, index) {
+				if reload[dep] {
+					reload[i] = true
+					changed = true
+					break
 				}
 			}
 		}
 	}
-	c.ready = false
+
+	var objects []*inject.Object
+	for i, obj := range order {
+		if reload[i] {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// rollback shuts down the services started by a failed Ready, in reverse
+// startup order.
+func (c *container) rollback(objects []*inject.Object) {
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := objects[i]
+		if err := c.shutdownService(obj.Name, obj.Value); err != nil {
+			log.Printf("ERROR: [rolling back] %s: %v", obj.Name, err)
+		}
+
+		c.mu.Lock()
+		delete(c.started, obj.Name)
+		delete(c.up, obj.Name)
+		delete(c.signals, obj.Name)
+		c.mu.Unlock()
+	}
+}
+
+// recovered wraps a lifecycle hook of the service so that a panic is returned
+// as an error, unless disabled with WithRecoverPanics.
+func (c *container) recovered(key, phase string, hook func() error) func() error {
+	if c.propagatePanics {
+		return hook
+	}
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("service %s panicked during %s: %v\n%s", key, phase, r, debug.Stack())
+			}
+		}()
+		return hook()
+	}
+}
+
+// watchStartup starts the service, calling the watchdog's onStuck if it
+// takes longer than configured by WithStartupWatchdog, and records the
+// startup in the transcript.
+func (c *container) watchStartup(key string, start func() error) (err error) {
+	defer func(begin time.Time) { c.record("startup", key, begin, err) }(time.Now())
+	if c.watchdog <= 0 || c.onStuck == nil {
+		return c.startService(key, start)
+	}
+
+	timer := time.AfterFunc(c.watchdog, func() { c.onStuck(key) })
+	defer timer.Stop()
+	return c.startService(key, start)
+}
+
+// startService runs the service's startup, retrying retryable failures as
+// configured by WithStartupRetry.
+func (c *container) startService(key string, start func() error) error {
+	backoff := c.startupBackoff
+	for attempt := 1; ; attempt++ {
+		err := start()
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if attempt >= c.startupAttempts || errors.As(err, &permanent) {
+			return err
+		}
+
+		log.Printf("ERROR: [starting up] %s: attempt %d failed, retrying in %s: %v", key, attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// DegradedError is returned by Ready when every critical service started but
+// some non-critical ones failed to. The container is ready regardless.
+type DegradedError struct {
+	Failures map[string]error // Startup errors keyed by service id
+}
+
+func (e *DegradedError) Error() string {
+	ids := make([]string, 0, len(e.Failures))
+	for id := range e.Failures {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	failures := make([]string, 0, len(ids))
+	for _, id := range ids {
+		failures = append(failures, fmt.Sprintf("%s: %v", id, e.Failures[id]))
+	}
+	return "non-critical services failed to start: " + strings.Join(failures, "; ")
+}
+
+func (e *DegradedError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, err := range e.Failures {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Permanent marks a Startup error as not retryable.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// unusedServices returns the ids of registered services that no object in
+// the graph depends on and that don't implement a lifecycle interface. The
+// caller must hold c.mu.
+func (c *container) unusedServices() []string {
+	used := make(map[*inject.Object]bool)
+	for _, o := range c.graph.Objects() {
+		for _, dep := range o.Fields {
+			used[dep] = true
+		}
+	}
+
+	var unused []string
+	for _, obj := range c.orderedObjects() {
+		switch obj.Value.(type) {
+		case Starter, Stopper, ContextStarter, ContextStopper, io.Closer:
+			continue
+		}
+		if !used[obj] {
+			unused = append(unused, obj.Name)
+		}
+	}
+	return unused
+}
+
+// ValidateAll wires the graph without starting any service and reports every
+// wiring error at once, joined with errors.Join.
+func (c *container) ValidateAll() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.provideServices(); err != nil {
+		return err
+	}
+	return errors.Join(c.graph.PopulateAll()...)
+}
+
+// ServicesID is the reserved id under which the container provides a map of
+// every service keyed by id, as in:
+//
+//	All map[string]interface{} `inject:"services"`
+//
+// The map is a snapshot taken each time the container populates its graph,
+// including the services of the parent of a scope. Services that were
+// already started keep the snapshot they were given. It is only provided
+// once a registered service has a field tagged with the id.
+const ServicesID = "services"
+
+// wantsServices reports whether a registered service has a field tagged with
+// ServicesID. The caller must hold c.mu.
+func (c *container) wantsServices() bool {
+	for _, obj := range c.services {
+		t := reflect.TypeOf(obj.Value)
+		if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		for i := 0; i < t.Elem().NumField(); i++ {
+			name, _, _ := strings.Cut(t.Elem().Field(i).Tag.Get("inject"), ",")
+			if name == ServicesID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// provideServices provides or refreshes the snapshot of the services under
+// ServicesID. The caller must hold c.mu.
+func (c *container) provideServices() error {
+	if c.snapshot == nil && !c.wantsServices() {
+		return nil
+	}
+
+	snapshot := make(map[string]interface{}, len(c.services))
+	if c.parent != nil {
+		for id, svc := range c.parent.Snapshot() {
+			snapshot[id] = svc
+		}
+	}
+	for id, obj := range c.services {
+		snapshot[id] = obj.Value
+	}
+
+	if c.snapshot == nil {
+		c.snapshot = &inject.Object{Name: ServicesID, Value: snapshot}
+		return c.graph.Provide(c.snapshot)
+	}
+	if g, ok := c.graph.(*inject.Graph); ok {
+		return g.Replace(c.snapshot, snapshot)
+	}
+	return nil
+}
+
+// orderedObjects returns the registered objects in registration order. The
+// caller must hold c.mu.
+func (c *container) orderedObjects() []*inject.Object {
+	objects := make([]*inject.Object, 0, len(c.order))
+	for _, id := range c.order {
+		objects = append(objects, c.services[id])
+	}
+	return objects
+}
+
+// startupOrder returns the registered objects in the order they start. A
+// service starts after the services it depends on, directly or through
+// objects created by the graph, and after those declared with DependsOn.
+// Otherwise services start by priority, and then in registration order.
+// Services in a dependency cycle fall back to priority and registration
+// order. The caller must hold c.mu.
+func (c *container) startupOrder() []*inject.Object {
+	objects := c.orderedObjects()
+	index := make(map[*inject.Object]int, len(objects))
+	for i, obj := range objects {
+		index[obj] = i
+	}
+
+	// dependents[i] lists the services depending on service i, and pending[i]
+	// counts the dependencies of service i that have not started yet.
+	dependents := make([][]int, len(objects))
+	pending := make([]int, len(objects))
+	for i, obj := range objects {
+		for _, dep := range c.startupDependencies(obj, index) {
+			dependents[dep] = append(dependents[dep], i)
+			pending[i]++
+		}
+	}
+
+	less := func(a, b int) bool {
+		pa, pb := c.priority[objects[a].Name], c.priority[objects[b].Name]
+		if pa != pb {
+			return pa < pb
+		}
+		return a < b
+	}
+
+	var next []int
+	for i := range objects {
+		if pending[i] == 0 {
+			next = append(next, i)
+		}
+	}
+
+	done := make([]bool, len(objects))
+	order := make([]*inject.Object, 0, len(objects))
+	for len(order) < len(objects) {
+		if len(next) == 0 {
+			// Only services in a cycle remain, so break it at the first one.
+			first := -1
+			for i := range objects {
+				if !done[i] && (first < 0 || less(i, first)) {
+					first = i
+				}
+			}
+			next = append(next, first)
+		}
+		sort.Slice(next, func(a, b int) bool { return less(next[a], next[b]) })
+
+		i := next[0]
+		next = next[1:]
+		done[i] = true
+		order = append(order, objects[i])
+		for _, dependent := range dependents[i] {
+			pending[dependent]--
+			if pending[dependent] == 0 && !done[dependent] {
+				next = append(next, dependent)
+			}
+		}
+	}
+	return order
+}
+
+// startupDependencies returns the indexes of the services obj starts after:
+// those it depends on through its fields and those declared with DependsOn.
+// The caller must hold c.mu.
+func (c *container) startupDependencies(obj *inject.Object, index map[*inject.Object]int) []int {
+	deps := serviceDependencies(obj, index)
+	for _, id := range c.requires[obj.Name] {
+		if dep, ok := index[c.services[id]]; ok {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// shutdownLevels groups the registered objects by dependency level, in the
+// order they shut down: the services nothing depends on first, and the
+// services with no dependencies last. Services within a level don't depend
+// on each other. The caller must hold c.mu.
+func (c *container) shutdownLevels() [][]*inject.Object {
+	order := c.startupOrder()
+	index := make(map[*inject.Object]int, len(order))
+	for i, obj := range order {
+		index[obj] = i
+	}
+
+	var levels [][]*inject.Object
+	level := make([]int, len(order))
+	for i, obj := range order {
+		for _, dep := range c.startupDependencies(obj, index) {
+			// Dependencies starting later are part of a cycle, so ignore them.
+			if dep < i && level[dep]+1 > level[i] {
+				level[i] = level[dep] + 1
+			}
+		}
+		if level[i] == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[level[i]] = append(levels[level[i]], obj)
+	}
+	slices.Reverse(levels)
+	return levels
+}
+
+// serviceDependencies returns the indexes of the services obj depends on,
+// looking through the objects created by the graph that lie in between.
+func serviceDependencies(obj *inject.Object, index map[*inject.Object]int) []int {
+	var deps []int
+	seen := map[*inject.Object]bool{obj: true}
+	var visit func(o *inject.Object)
+	visit = func(o *inject.Object) {
+		fields := make([]string, 0, len(o.Fields))
+		for field := range o.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			dep := o.Fields[field]
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if i, ok := index[dep]; ok {
+				deps = append(deps, i)
+				continue
+			}
+			visit(dep)
+		}
+	}
+	visit(obj)
+	return deps
+}
+
+type containerKey struct{}
+
+// FromContext returns the container attached to a context passed to
+// ContextStarter.StartupContext.
+func FromContext(ctx context.Context) (Container, bool) {
+	c, ok := ctx.Value(containerKey{}).(Container)
+	return c, ok
+}
+
+// MustReady calls Ready on the container and panics if any critical service
+// fails to start. Failures of non-critical services are logged. It is
+// intended for simple mains where a failed boot is fatal.
+func MustReady(c Container) {
+	err := c.Ready()
+	var degraded *DegradedError
+	if errors.As(err, &degraded) {
+		log.Printf("warning: %v", err)
+		return
+	}
+	if err != nil {
+		panic(fmt.Errorf("container is not ready: %w", err))
+	}
+}
+
+func (c *container) RegisterService(id string, svc interface{}) {
+	if _, err := c.register(id, 0, svc); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterServiceObj registers a service like RegisterService, returning the
+// object provided to the graph instead of panicking on failure. The object
+// can be inspected or configured further before Ready, for example marked
+// Complete.
+func (c *container) RegisterServiceObj(id string, svc interface{}) (*inject.Object, error) {
+	return c.register(id, 0, svc)
+}
+
+// RegisterServiceWithPriority registers a service like RegisterService with
+// a startup priority. Services with lower priorities start earlier, unless
+// they depend on a service with a higher one. Services registered without a
+// priority have priority 0.
+func (c *container) RegisterServiceWithPriority(id string, priority int, svc interface{}) {
+	if _, err := c.register(id, priority, svc); err != nil {
+		panic(err)
+	}
+}
+
+// DependsOn declares that the service id starts after the services depIDs,
+// as if it had a field injected with each of them. Unknown ids and cycles
+// among declared dependencies are reported by Ready.
+func (c *container) DependsOn(id string, depIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.requires == nil {
+		c.requires = make(map[string][]string)
+	}
+	c.requires[id] = append(c.requires[id], depIDs...)
+}
+
+// BindInterface declares that untagged fields of the interface type pointed
+// to by ifacePtr, such as (*Cache)(nil), get the service implID, even when
+// other objects implement the interface too. It panics if ifacePtr is not a
+// pointer to an interface. It only applies to containers backed by an
+// *inject.Graph.
+func (c *container) BindInterface(ifacePtr interface{}, implID string) {
+	t := reflect.TypeOf(ifacePtr)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		panic(fmt.Errorf("failed to bind service %s: %T is not a pointer to an interface", implID, ifacePtr))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.graph.(*inject.Graph)
+	if !ok {
+		panic(fmt.Errorf("failed to bind service %s: graph %T does not support bindings", implID, c.graph))
+	}
+	if g.Bindings == nil {
+		g.Bindings = make(map[reflect.Type]string)
+	}
+	g.Bindings[t.Elem()] = implID
+}
+
+// checkDependsOn validates the dependencies declared with DependsOn. Ids of
+// services disabled by RegisterServiceIf are known but have no dependencies.
+// The caller must hold c.mu.
+func (c *container) checkDependsOn() error {
+	ids := make([]string, 0, len(c.requires))
+	for id := range c.requires {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	known := func(id string) bool {
+		return c.services[id] != nil || c.disabled[id]
+	}
+	for _, id := range ids {
+		if !known(id) {
+			return fmt.Errorf("dependencies declared for unknown service %s", id)
+		}
+		for _, dep := range c.requires[id] {
+			if !known(dep) {
+				return fmt.Errorf("service %s depends on unknown service %s", id, dep)
+			}
+		}
+	}
+
+	// Depth first search for a path returning to a service on the stack.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			start := 0
+			for path[start] != id {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), id)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range c.requires[id] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+	for _, id := range ids {
+		if err := visit(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterServiceCritical registers a service like RegisterService, stating
+// whether it is critical. Services are critical by default. When a
+// non-critical service fails to start, Ready logs the failure and carries on
+// with the other services, and then returns a *DegradedError.
+func (c *container) RegisterServiceCritical(id string, critical bool, svc interface{}) {
+	c.mu.Lock()
+	if !critical && c.services[id] == nil {
+		if c.optional == nil {
+			c.optional = make(map[string]bool)
+		}
+		c.optional[id] = true
+	}
+	c.mu.Unlock()
+
+	if _, err := c.register(id, 0, svc); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterAll registers every service in the map. Services are registered in
+// the sorted order of their ids, so that startup order is reproducible. A
+// failing registration doesn't stop the others, and all errors are returned
+// joined with errors.Join.
+func (c *container) RegisterAll(services map[string]interface{}) error {
+	ids := make([]string, 0, len(services))
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs []error
+	for _, id := range ids {
+		if _, err := c.register(id, 0, services[id]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MustRegisterAll calls RegisterAll on the container and panics if any
+// service fails to register.
+func MustRegisterAll(c Container, services map[string]interface{}) {
+	if err := c.RegisterAll(services); err != nil {
+		panic(err)
+	}
+}
+
+// register provides the service to the graph with the given startup
+// priority, applying the post-ready policy, and returns its object.
+func (c *container) register(id string, priority int, svc interface{}) (*inject.Object, error) {
+	c.mu.Lock()
+
+	late := c.ready
+	autoStart := false
+	if late {
+		switch c.postReadyPolicy {
+		case PostReadyAllow:
+			log.Printf("warning: registering service %s after container is ready", id)
+		case PostReadyAutoStart:
+			autoStart = true
+		default:
+			c.mu.Unlock()
+			return nil, fmt.Errorf("failed to register service %s: %w", id, ErrRegisteredAfterReady)
+		}
+	}
+
+	if id == ServicesID {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("failed to register service %s: the id is reserved", id)
+	}
+	obj := &inject.Object{Name: id, Value: svc, Complete: false}
+	err := c.graph.Provide(obj)
+	if err != nil {
+		c.mu.Unlock()
+		log.Printf("error providing service %s: %v", id, err)
+		return nil, fmt.Errorf("failed to register service %s: %w", id, err)
+	}
+	c.order = append(c.order, id)
+	c.services[id] = obj
+	if priority != 0 {
+		if c.priority == nil {
+			c.priority = make(map[string]int)
+		}
+		c.priority[id] = priority
+	}
+	if late {
+		// The next Ready wires and starts the late service.
+		c.ready = false
+	}
+	c.mu.Unlock()
+
+	if autoStart {
+		if err := c.Ready(); err != nil {
+			return obj, fmt.Errorf("failed to start late service %s: %w", id, err)
+		}
+	}
+	return obj, nil
+}
+
+// ReplaceService swaps the instance of a registered service for svc, which
+// must be of the same type. It must be called before Ready: services that
+// were already wired to the old instance, for example by ValidateAll, are
+// wired again to the new one by Ready. It only applies to containers backed by
+// an *inject.Graph.
+func (c *container) ReplaceService(id string, svc interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ready {
+		return fmt.Errorf("failed to replace service %s: %w", id, ErrRegisteredAfterReady)
+	}
+	obj := c.services[id]
+	if obj == nil {
+		return fmt.Errorf("failed to replace service %s: service not found", id)
+	}
+	g, ok := c.graph.(*inject.Graph)
+	if !ok {
+		return fmt.Errorf("failed to replace service %s: graph %T does not support replacement", id, c.graph)
+	}
+	if err := g.Replace(obj, svc); err != nil {
+		return fmt.Errorf("failed to replace service %s: %w", id, err)
+	}
+	return nil
+}
+
+// MarkComplete declares the registered service id as already wired, so that
+// populating the graph leaves its fields alone, for example when a factory
+// built it entirely. It must be called before Ready.
+func (c *container) MarkComplete(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ready {
+		return fmt.Errorf("failed to mark service %s complete: %w", id, ErrRegisteredAfterReady)
+	}
+	obj := c.services[id]
+	if obj == nil {
+		return fmt.Errorf("failed to mark service %s complete: service not found", id)
+	}
+	obj.Complete = true
+	return nil
+}
+
+// RegisterServiceIf registers the service only when cond returns true at
+// registration time. A disabled service is neither provided to the graph nor
+// started, and GetServiceOrNil returns nil for it.
+func (c *container) RegisterServiceIf(id string, svc interface{}, cond func() bool) {
+	if cond() {
+		c.RegisterService(id, svc)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.disabled == nil {
+		c.disabled = make(map[string]bool)
+	}
+	c.disabled[id] = true
+}
+
+// ProvideValue makes a fully-constructed value injectable by type. The value
+// is provided as a complete, unnamed object: its fields are never populated
+// and it is neither started nor shut down by the container.
+func (c *container) ProvideValue(value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.graph.Provide(&inject.Object{Value: value, Complete: true}); err != nil {
+		panic(fmt.Errorf("failed to provide value of type %T: %w", value, err))
+	}
+}
+
+// Import merges the objects of another graph into the container, so that
+// sub-graphs built independently can be composed. Named objects become
+// services registered after the existing ones, in the order of their names,
+// and unnamed objects become injectable by type. Objects the other graph
+// created or made private are not imported, and objects it marked complete
+// stay complete. Nothing is imported if an id or unnamed type collides with
+// one the container already has, or if the container is ready.
+func (c *container) Import(g *inject.Graph) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ready {
+		return fmt.Errorf("failed to import graph: %w", ErrRegisteredAfterReady)
+	}
+
+	existing := make(map[reflect.Type]bool)
+	for _, o := range c.graph.Objects() {
+		if o.Name == "" && !o.IsPrivate() {
+			existing[o.Type()] = true
+		}
+	}
+
+	var named, unnamed []*inject.Object
+	var errs []error
+	for _, o := range g.Objects() {
+		switch {
+		case o.IsPrivate() || o.IsCreated():
+		case o.Name != "":
+			if c.services[o.Name] != nil || c.disabled[o.Name] {
+				errs = append(errs, fmt.Errorf("service %s is already registered", o.Name))
+			}
+			named = append(named, o)
+		default:
+			if existing[o.Type()] {
+				errs = append(errs, fmt.Errorf("an unnamed object of type %s is already provided", o.Type()))
+			}
+			unnamed = append(unnamed, o)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to import graph: %w", errors.Join(errs...))
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].Name < named[j].Name })
+
+	for _, o := range unnamed {
+		if err := c.graph.Provide(&inject.Object{Value: o.Value, Complete: o.Complete, Tags: o.Tags}); err != nil {
+			return fmt.Errorf("failed to import graph: %w", err)
+		}
+	}
+	for _, o := range named {
+		obj := &inject.Object{Name: o.Name, Value: o.Value, Complete: o.Complete, Tags: o.Tags}
+		if err := c.graph.Provide(obj); err != nil {
+			return fmt.Errorf("failed to import graph: %w", err)
+		}
+		c.order = append(c.order, o.Name)
+		c.services[o.Name] = obj
+	}
+	return nil
+}
+
+// IDs returns the ids of the registered services in registration order.
+func (c *container) IDs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]string, len(c.order))
+	copy(ids, c.order)
+	return ids
+}
+
+// Snapshot returns a shallow copy of the registered services keyed by id.
+// Changing the returned map doesn't affect the container.
+func (c *container) Snapshot() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(map[string]interface{}, len(c.services))
+	for id, obj := range c.services {
+		snapshot[id] = obj.Value
+	}
+	return snapshot
+}
+
+// RegisterProvider registers the service id as the pointer returned by fn, a
+// constructor taking its dependencies as parameters. Ready calls fn before
+// populating the graph, passing for each parameter the one non-private object
+// assignable to its type, and the service starts after the services passed to
+// it. It panics if fn is not a function returning a single pointer. It only
+// applies to containers backed by an *inject.Graph.
+func (c *container) RegisterProvider(id string, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.Type().IsVariadic() || v.Type().NumOut() != 1 || v.Type().Out(0).Kind() != reflect.Ptr {
+		panic(fmt.Errorf("failed to register provider %s: %T is not a function returning a pointer", id, fn))
+	}
+	// The service is a nil placeholder until Ready calls fn.
+	if _, err := c.register(id, 0, reflect.Zero(v.Type().Out(0)).Interface()); err != nil {
+		panic(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider == nil {
+		c.provider = make(map[string]reflect.Value)
+	}
+	c.provider[id] = v
+}
+
+// callProviders calls the provider functions not called yet, in registration
+// order except that a provider taking the result of another is called after
+// it. The caller must hold c.mu, which is released while providers run.
+func (c *container) callProviders() error {
+	for {
+		var waiting []string
+		called := false
+		for _, id := range c.order {
+			fn, ok := c.provider[id]
+			if !ok || !unprovided(c.services[id]) {
+				continue
+			}
+			ok, err := c.callProvider(id, fn)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				waiting = append(waiting, id)
+				continue
+			}
+			called = true
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		if !called {
+			return fmt.Errorf("failed to call providers: %s depend on each other", strings.Join(waiting, ", "))
+		}
+	}
+}
+
+// callProvider calls the provider of the service id and makes its result the
+// service. It returns false without calling it when one of its parameters is
+// the result of a provider not called yet. The caller must hold c.mu. The
+// provider is user code, so it runs without c.mu and may call back into the
+// container.
+func (c *container) callProvider(id string, fn reflect.Value) (bool, error) {
+	g, ok := c.graph.(*inject.Graph)
+	if !ok {
+		return false, fmt.Errorf("failed to call provider %s: graph %T does not support providers", id, c.graph)
+	}
+	args, deps, err := c.providerArgs(id, fn.Type())
+	if err != nil {
+		return false, err
+	}
+	if args == nil && fn.Type().NumIn() > 0 {
+		return false, nil
+	}
+
+	c.mu.Unlock()
+	svc := fn.Call(args)[0]
+	c.mu.Lock()
+	if svc.IsNil() {
+		return false, fmt.Errorf("failed to call provider %s: it returned nil", id)
+	}
+	if err := g.Replace(c.services[id], svc.Interface()); err != nil {
+		return false, fmt.Errorf("failed to call provider %s: %w", id, err)
+	}
+	for _, dep := range deps {
+		if !slices.Contains(c.requires[id], dep) {
+			if c.requires == nil {
+				c.requires = make(map[string][]string)
+			}
+			c.requires[id] = append(c.requires[id], dep)
+		}
+	}
+	return true, nil
+}
+
+// unprovided reports whether obj is the placeholder of a provider not called
+// yet.
+func unprovided(obj *inject.Object) bool {
+	return reflect.ValueOf(obj.Value).IsNil()
+}
+
+// providerArgs resolves the parameters of the provider of the service id,
+// returning nil arguments when one is the result of a provider not called
+// yet. deps holds the ids of the services among the arguments. The caller
+// must hold c.mu.
+func (c *container) providerArgs(id string, t reflect.Type) (args []reflect.Value, deps []string, err error) {
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		var matches []*inject.Object
+		for _, o := range c.graph.Objects() {
+			if !o.IsPrivate() && o != c.services[id] && o.Type().AssignableTo(in) {
+				matches = append(matches, o)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			return nil, nil, fmt.Errorf("failed to call provider %s: no value of type %s for parameter %d", id, in, i)
+		case 1:
+		default:
+			return nil, nil, fmt.Errorf(
+				"failed to call provider %s: found %d values of type %s for parameter %d: %s",
+				id, len(matches), in, i, strings.Join(objectIDs(matches), ", "))
+		}
+
+		match := matches[0]
+		if _, ok := c.provider[match.Name]; ok && c.services[match.Name] == match && unprovided(match) {
+			return nil, nil, nil
+		}
+		if c.services[match.Name] == match {
+			deps = append(deps, match.Name)
+		}
+		args = append(args, reflect.ValueOf(match.Value))
+	}
+	return args, deps, nil
+}
+
+// RegisterServiceInGroup registers a service like RegisterService and tags it
+// as a member of the given group.
+func (c *container) RegisterServiceInGroup(id, group string, svc interface{}) {
+	c.RegisterService(id, svc)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.groups == nil {
+		c.groups = make(map[string][]string)
+	}
+	c.groups[group] = append(c.groups[group], id)
+}
+
+// Group returns the services tagged with the given group in registration
+// order.
+func (c *container) Group(name string) []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := c.groups[name]
+	members := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, c.services[id].Value)
+	}
+	return members
+}
+
+// Describe returns a description of every registered service in
+// registration order. Dependencies are only known once the container is ready.
+func (c *container) Describe() []ServiceInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	infos := make([]ServiceInfo, 0, len(c.order))
+	for _, obj := range c.orderedObjects() {
+		_, isService := obj.Value.(Service)
+		_, isHealthChecker := obj.Value.(HealthChecker)
+		infos = append(infos, ServiceInfo{
+			ID:                      obj.Name,
+			TypeName:                fmt.Sprint(reflect.TypeOf(obj.Value)),
+			Dependencies:            dependencies(obj),
+			ImplementsService:       isService,
+			ImplementsHealthChecker: isHealthChecker,
+			Started:                 c.started[obj.Name],
+			Tags:                    maps.Clone(obj.Tags),
+		})
+	}
+	return infos
+}
+
+// Transcript returns the startups and teardowns of services in the order they
+// happened, with their timing and errors. Only the latest events are kept.
+func (c *container) Transcript() []LifecycleEvent {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.events)
+}
+
+// record appends an event to the transcript.
+func (c *container) record(phase, id string, begin time.Time, err error) {
+	event := LifecycleEvent{
+		Phase:     phase,
+		ID:        id,
+		StartedAt: begin,
+		Duration:  time.Since(begin),
+		Err:       err,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.events) == maxTranscript {
+		c.events = slices.Delete(c.events, 0, 1)
+	}
+	c.events = append(c.events, event)
+}
+
+// Health runs the health checks of the services implementing HealthChecker
+// concurrently and returns their results keyed by service id. A nil error
+// means the service is healthy. A check that doesn't return within its
+// timeout is reported with the context's error without waiting for it.
+func (c *container) Health(ctx context.Context) map[string]error {
+	c.mu.RLock()
+	objects := c.orderedObjects()
+	c.mu.RUnlock()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error)
+		limit   chan struct{}
+	)
+	if c.maxHealth > 0 {
+		limit = make(chan struct{}, c.maxHealth)
+	}
+	for _, obj := range objects {
+		checker, ok := obj.Value.(HealthChecker)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if limit != nil {
+				limit <- struct{}{}
+				defer func() { <-limit }()
+			}
+
+			err := c.checkHealth(ctx, id, checker)
+			mu.Lock()
+			results[id] = err
+			mu.Unlock()
+		}(obj.Name)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkHealth runs a single health check, honoring its timeout.
+func (c *container) checkHealth(ctx context.Context, id string, checker HealthChecker) error {
+	timeout := c.healthTimeout
+	if d, ok := c.healthTimeouts[id]; ok {
+		timeout = d
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- checker.HealthCheck(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dependencies lists the objects injected into obj, ordered by field name.
+// Named objects are identified by name and unnamed ones by type.
+func dependencies(obj *inject.Object) []string {
+	fields := make([]string, 0, len(obj.Fields))
+	for field := range obj.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	deps := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		dep := obj.Fields[field]
+		id := dep.Name
+		if id == "" {
+			id = fmt.Sprint(reflect.TypeOf(dep.Value))
+		}
+		if !seen[id] {
+			seen[id] = true
+			deps = append(deps, id)
+		}
+	}
+	return deps
+}
+
+// GetServiceOrNil returns the service registered as id, looking it up in the
+// parent of a scope as well, or nil if it was disabled by RegisterServiceIf.
+// It panics with a *ServiceNotFoundError if no service is registered as id.
+func (c *container) GetServiceOrNil(id string) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	obj, ok := c.services[id]
+	if !ok {
+		if c.disabled[id] {
+			return nil
+		}
+		if c.parent != nil {
+			return c.parent.GetServiceOrNil(id)
+		}
+		panic(&ServiceNotFoundError{ID: id})
+	}
+	// Return the value held by the graph's object, which is the instance
+	// that was populated and started.
+	return obj.Value
+}
+
+// GetByType returns the one object in the graph assignable to t, named or
+// unnamed. Private objects are not considered. It fails if there is no such
+// object or more than one.
+func (c *container) GetByType(t reflect.Type) (interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var matches []*inject.Object
+	for _, o := range c.graph.Objects() {
+		if !o.IsPrivate() && o.Type().AssignableTo(t) {
+			matches = append(matches, o)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no service of type %s found", t)
+	case 1:
+		return matches[0].Value, nil
+	}
+
+	return nil, fmt.Errorf("found %d services of type %s: %s", len(matches), t, strings.Join(objectIDs(matches), ", "))
+}
+
+// objectIDs returns the sorted names of objects, or the types of unnamed ones.
+func objectIDs(objects []*inject.Object) []string {
+	ids := make([]string, 0, len(objects))
+	for _, o := range objects {
+		id := o.Name
+		if id == "" {
+			id = o.Type().String()
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetType returns the one object in the container's graph of type T, as
+// GetByType does. T may be an interface.
+func GetType[T any](c Container) (T, error) {
+	var zero T
+	value, err := c.GetByType(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return zero, err
+	}
+	return value.(T), nil
+}
+
+// Scope returns a child container for scope-local services, such as those of
+// a single request. The objects of the parent's graph at the time of the call
+// are injectable into the child's services by reference, but they are never
+// populated, started or shut down by the child. Services registered with the
+// child don't leak to the parent, and lookups of ids unknown to the child
+// fall through to the parent.
+func (c *container) Scope() Container {
+	g := new(inject.Graph)
+	if parent, ok := c.graph.(*inject.Graph); ok {
+		g.Logger = parent.Logger
+		g.Values = parent.Values
+		g.Resolvers = parent.Resolvers
+		g.ObjectResolvers = slices.Clip(parent.ObjectResolvers)
+		g.Constructors = parent.Constructors
+		g.UsePool = parent.UsePool
+		g.NameByField = parent.NameByField
+		g.AutoInline = parent.AutoInline
+		g.Adapters = parent.Adapters
+		g.Bindings = maps.Clone(parent.Bindings)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, o := range c.graph.Objects() {
+		if o.IsPrivate() || o == c.snapshot {
+			continue
+		}
+		if err := g.Provide(&inject.Object{Name: o.Name, Value: o.Value, Complete: true, Tags: o.Tags}); err != nil {
+			panic(fmt.Errorf("failed to create scope: %w", err))
+		}
+	}
+
+	child := NewWithGraph(g).(*container)
+	child.parent = c
+	child.shutdownTimeout = c.shutdownTimeout
+	child.startupAttempts = c.startupAttempts
+	child.startupBackoff = c.startupBackoff
+	child.strictUnused = c.strictUnused
+	child.postReadyPolicy = c.postReadyPolicy
+	child.healthTimeout = c.healthTimeout
+	child.healthTimeouts = c.healthTimeouts
+	child.maxHealth = c.maxHealth
+	child.maxShutdown = c.maxShutdown
+	child.watchdog = c.watchdog
+	child.onStuck = c.onStuck
+	child.onStarted = c.onStarted
+	child.onStopped = c.onStopped
+	child.propagatePanics = c.propagatePanics
+	child.clock = c.clock
+	return child
+}
+
+// Shutdown tears down the services in reverse startup order, so that a
+// service stops before those it depends on, skipping those that never
+// started or that a failed Ready already rolled back. Calling it
+// again is a no-op until the container is made ready again, which restarts
+// every service from scratch.
+func (c *container) Shutdown() {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+
+	c.mu.RLock()
+	select {
+	case <-c.stopped:
+		c.mu.RUnlock()
+		return
+	default:
+	}
+	// Only services that are up are torn down, so that those never started,
+	// or already rolled back by a failed Ready, are not stopped again.
+	var objects []*inject.Object
+	for _, obj := range slices.Backward(c.startupOrder()) {
+		if c.up[obj.Name] {
+			objects = append(objects, obj)
+		}
+	}
+	var levels [][]*inject.Object
+	if c.maxShutdown > 0 {
+		for _, level := range c.shutdownLevels() {
+			level = slices.DeleteFunc(level, func(obj *inject.Object) bool { return !c.up[obj.Name] })
+			if len(level) > 0 {
+				levels = append(levels, level)
+			}
+		}
+	}
+	c.mu.RUnlock()
+
+	if levels == nil {
+		for _, obj := range objects {
+			if err := c.shutdownService(obj.Name, obj.Value); err != nil {
+				log.Printf("ERROR: [shutting down] %s: %v", obj.Name, err)
+			}
+		}
+	}
+	for _, level := range levels {
+		if err := c.shutdownLevel(level); err != nil {
+			log.Printf("ERROR: [shutting down] %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.ready = false
+	clear(c.started)
+	clear(c.up)
+	clear(c.prepared)
+	clear(c.signals)
+	close(c.stopped)
+	c.mu.Unlock()
+}
+
+// shutdownLevel tears down the services of a dependency level concurrently,
+// at most maxShutdown at a time, and returns their errors joined.
+func (c *container) shutdownLevel(objects []*inject.Object) error {
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, c.maxShutdown)
+	errs := make([]error, len(objects))
+	for i, obj := range objects {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+			if err := c.shutdownService(obj.Name, obj.Value); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", obj.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Wait blocks until Shutdown has completed. It returns immediately if the
+// container was already shut down.
+func (c *container) Wait() {
+	c.mu.RLock()
+	stopped := c.stopped
+	c.mu.RUnlock()
+
+	<-stopped
+}
+
+// shutdownService tears down a single service, honoring the configured
+// shutdown timeout. Services that only implement io.Closer are closed, and
+// services that don't participate in the lifecycle are ignored.
+func (c *container) shutdownService(key string, service interface{}) error {
+	var stop func(ctx context.Context) error
+	switch s := service.(type) {
+	case ContextStopper:
+		stop = s.ShutdownContext
+	case Stopper:
+		stop = func(context.Context) error { return s.Shutdown() }
+	case io.Closer:
+		stop = func(context.Context) error { return s.Close() }
+	default:
+		return nil
+	}
+
+	log.Println("[shutting down] ", key)
+	guarded := func(ctx context.Context) error {
+		return c.recovered(key, "shutdown", func() error { return stop(ctx) })()
+	}
+	begin := time.Now()
+	err := c.stopWithTimeout(guarded)
+	c.record("shutdown", key, begin, err)
+	if err != nil {
+		return err
+	}
+	if c.onStopped != nil {
+		c.onStopped(key)
+	}
+	return nil
+}
+
+// stopWithTimeout runs stop, giving up after the configured shutdown timeout.
+func (c *container) stopWithTimeout(stop func(ctx context.Context) error) error {
+	if c.shutdownTimeout <= 0 {
+		return stop(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- stop(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s: %w", c.shutdownTimeout, ctx.Err())
+	}
 }
@@ -0,0 +1,2897 @@
+package gontainer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tommynurwantoro/gontainer"
+	"github.com/tommynurwantoro/gontainer/inject"
+)
+
+type TypeFailingService struct{}
+
+func (s *TypeFailingService) Startup() error  { return errors.New("boom") }
+func (s *TypeFailingService) Shutdown() error { return nil }
+
+func TestMustReadyPanicsWithServiceID(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("failing", &TypeFailingService{})
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected MustReady to panic")
+		}
+		err, ok := r.(error)
+		if !ok {
+			t.Fatalf("expected panic value to be an error, got %T", r)
+		}
+		const msg = "container is not ready: failed to start service failing: boom"
+		if err.Error() != msg {
+			t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+		}
+	}()
+	gontainer.MustReady(c)
+}
+
+type TypeRecordingService struct {
+	started bool
+	stopped bool
+}
+
+func (s *TypeRecordingService) Startup() error  { s.started = true; return nil }
+func (s *TypeRecordingService) Shutdown() error { s.stopped = true; return nil }
+
+func TestMustReady(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeRecordingService{}
+	c.RegisterService("svc", svc)
+
+	gontainer.MustReady(c)
+	if !svc.started {
+		t.Fatal("expected service to be started")
+	}
+	if c.GetServiceOrNil("svc") != svc {
+		t.Fatal("expected to get the started service back")
+	}
+}
+
+type TypeBlockingShutdownService struct {
+	release chan struct{}
+}
+
+func (s *TypeBlockingShutdownService) Startup() error { return nil }
+func (s *TypeBlockingShutdownService) Shutdown() error {
+	<-s.release
+	return nil
+}
+
+type TypeContextShutdownService struct {
+	errs chan error
+}
+
+func (s *TypeContextShutdownService) Startup() error  { return nil }
+func (s *TypeContextShutdownService) Shutdown() error { return nil }
+func (s *TypeContextShutdownService) ShutdownContext(ctx context.Context) error {
+	<-ctx.Done()
+	s.errs <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestShutdownTimeoutDoesNotHang(t *testing.T) {
+	c := gontainer.New(gontainer.WithShutdownTimeout(10 * time.Millisecond))
+	blocking := &TypeBlockingShutdownService{release: make(chan struct{})}
+	defer close(blocking.release)
+	next := &TypeRecordingService{}
+	c.RegisterService("blocking", blocking)
+	c.RegisterService("next", next)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown hung on a blocking service")
+	}
+	if !next.stopped {
+		t.Fatal("expected teardown to continue to the next service")
+	}
+}
+
+func TestShutdownTimeoutCancelsContext(t *testing.T) {
+	c := gontainer.New(gontainer.WithShutdownTimeout(10 * time.Millisecond))
+	svc := &TypeContextShutdownService{errs: make(chan error, 1)}
+	c.RegisterService("svc", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Shutdown()
+	if err := <-svc.errs; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline to be exceeded, got %v", err)
+	}
+}
+
+type TypeDependency struct{}
+
+type TypeWiredService struct {
+	Dep     *TypeDependency `inject:""`
+	started bool
+}
+
+func (s *TypeWiredService) Startup() error  { s.started = s.Dep != nil; return nil }
+func (s *TypeWiredService) Shutdown() error { return nil }
+
+func TestGetServiceOrNilPanicsWithServiceNotFound(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("present", &TypeRecordingService{})
+
+	defer func() {
+		err, _ := recover().(error)
+		var notFound *gontainer.ServiceNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Fatalf("expected panic with *ServiceNotFoundError, got %v", err)
+		}
+		if notFound.ID != "missing" {
+			t.Fatalf("expected id missing, got %s", notFound.ID)
+		}
+		const msg = "service missing not found"
+		if err.Error() != msg {
+			t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+		}
+	}()
+	c.Scope().GetServiceOrNil("missing")
+}
+
+func TestGetServiceOrNilReturnsPopulatedInstance(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("wired", &TypeWiredService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := c.GetServiceOrNil("wired").(*TypeWiredService)
+	if svc.Dep == nil {
+		t.Fatal("expected the returned service to be populated")
+	}
+	if !svc.started {
+		t.Fatal("expected the returned service to be the started instance")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	c := gontainer.New()
+	a := &TypeRecordingService{}
+	b := &TypeRecordingService{}
+	d := &TypeDependency{}
+	c.RegisterServiceInGroup("a", "background", a)
+	c.RegisterServiceInGroup("metrics", "metrics", d)
+	c.RegisterServiceInGroup("b", "background", b)
+	c.RegisterService("other", &TypeRecordingService{})
+
+	background := c.Group("background")
+	if len(background) != 2 || background[0] != a || background[1] != b {
+		t.Fatalf("expected background group [a b], got %v", background)
+	}
+	metrics := c.Group("metrics")
+	if len(metrics) != 1 || metrics[0] != d {
+		t.Fatalf("expected metrics group [metrics], got %v", metrics)
+	}
+	if unknown := c.Group("unknown"); len(unknown) != 0 {
+		t.Fatalf("expected unknown group to be empty, got %v", unknown)
+	}
+}
+
+type TypeConfiguredService struct {
+	MaxConns int    `inject:"value:maxConns"`
+	Name     string `inject:"value:name"`
+}
+
+func TestWithValues(t *testing.T) {
+	c := gontainer.New(gontainer.WithValues(map[string]interface{}{
+		"maxConns": 16,
+		"name":     "api",
+	}))
+	svc := &TypeConfiguredService{}
+	c.RegisterService("svc", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.MaxConns != 16 || svc.Name != "api" {
+		t.Fatalf("expected values to be injected, got %+v", svc)
+	}
+}
+
+type TypeLookupService struct {
+	c     gontainer.Container
+	found interface{}
+}
+
+func (s *TypeLookupService) Startup() error {
+	s.found = s.c.GetServiceOrNil("dep")
+	return nil
+}
+
+func (s *TypeLookupService) Shutdown() error {
+	s.found = s.c.GetServiceOrNil("dep")
+	return nil
+}
+
+func TestServiceCallbacksCanLookupServices(t *testing.T) {
+	c := gontainer.New()
+	dep := &TypeDependency{}
+	svc := &TypeLookupService{c: c}
+	c.RegisterService("dep", dep)
+	c.RegisterService("lookup", svc)
+
+	done := make(chan error, 1)
+	go func() {
+		err := c.Ready()
+		c.Shutdown()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deadlocked looking up a service from a lifecycle hook")
+	}
+	if svc.found != dep {
+		t.Fatalf("expected to find dep, got %v", svc.found)
+	}
+}
+
+type TypeHealthyService struct {
+	Dep   *TypeDependency       `inject:""`
+	Wired *TypeWiredService     `inject:"wired"`
+	Other *TypeRecordingService `inject:"recording"`
+}
+
+func (s *TypeHealthyService) HealthCheck(ctx context.Context) error { return nil }
+
+func TestDescribe(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("recording", &TypeRecordingService{})
+	c.RegisterService("wired", &TypeWiredService{})
+	c.RegisterService("healthy", &TypeHealthyService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []gontainer.ServiceInfo{
+		{
+			ID:                "recording",
+			TypeName:          "*gontainer_test.TypeRecordingService",
+			Dependencies:      []string{},
+			ImplementsService: true,
+			Started:           true,
+		},
+		{
+			ID:                "wired",
+			TypeName:          "*gontainer_test.TypeWiredService",
+			Dependencies:      []string{"*gontainer_test.TypeDependency"},
+			ImplementsService: true,
+			Started:           true,
+		},
+		{
+			ID:                      "healthy",
+			TypeName:                "*gontainer_test.TypeHealthyService",
+			Dependencies:            []string{"*gontainer_test.TypeDependency", "recording", "wired"},
+			ImplementsHealthChecker: true,
+		},
+	}
+	if actual := c.Describe(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected:\n%+v\nactual:\n%+v", expected, actual)
+	}
+}
+
+func TestDescribeTags(t *testing.T) {
+	c := gontainer.New()
+	obj, err := c.RegisterServiceObj("legacy", &TypeRecordingService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Tags = map[string]string{"owner": "billing", "deprecated": "replaced by invoices"}
+	c.RegisterService("plain", &TypeRecordingService{})
+
+	infos := c.Describe()
+	if !reflect.DeepEqual(infos[0].Tags, obj.Tags) {
+		t.Fatalf("expected %v, got %v", obj.Tags, infos[0].Tags)
+	}
+	if infos[1].Tags != nil {
+		t.Fatalf("expected no tags, got %v", infos[1].Tags)
+	}
+}
+
+type TypeLazyService struct {
+	First  func() *TypeConstructedDependency `inject:",lazy"`
+	Second func() *TypeRecordingService      `inject:",lazy"`
+}
+
+func TestLazyProvidersAlongsideDescribe(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeLazyService{}
+	c.RegisterService("lazy", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); svc.First() }()
+	go func() { defer wg.Done(); svc.Second() }()
+	go func() { defer wg.Done(); c.Describe() }()
+	wg.Wait()
+
+	if svc.First() == nil || svc.Second() == nil {
+		t.Fatal("expected both providers to return their dependency")
+	}
+}
+
+type TypeFlakyService struct {
+	failures int
+	attempts int
+	err      error
+}
+
+func (s *TypeFlakyService) Startup() error {
+	s.attempts++
+	if s.attempts <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *TypeFlakyService) Shutdown() error { return nil }
+
+func TestStartupRetry(t *testing.T) {
+	c := gontainer.New(gontainer.WithStartupRetry(3, time.Millisecond))
+	svc := &TypeFlakyService{failures: 2, err: errors.New("not yet")}
+	c.RegisterService("flaky", svc)
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", svc.attempts)
+	}
+}
+
+func TestStartupRetryGivesUp(t *testing.T) {
+	c := gontainer.New(gontainer.WithStartupRetry(2, time.Millisecond))
+	svc := &TypeFlakyService{failures: 5, err: errors.New("not yet")}
+	c.RegisterService("flaky", svc)
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+	const msg = "failed to start service flaky: not yet"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	if svc.attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", svc.attempts)
+	}
+}
+
+func TestStartupRetrySkipsPermanentErrors(t *testing.T) {
+	c := gontainer.New(gontainer.WithStartupRetry(3, time.Millisecond))
+	cause := errors.New("bad config")
+	svc := &TypeFlakyService{failures: 5, err: gontainer.Permanent(cause)}
+	c.RegisterService("flaky", svc)
+
+	err := c.Ready()
+	if !errors.Is(err, cause) {
+		t.Fatalf("expected error wrapping %v, got %v", cause, err)
+	}
+	if svc.attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", svc.attempts)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeFlakyService{failures: 1, err: errors.New("not yet")}
+	c.RegisterService("flaky", svc)
+
+	if err := c.Ready(); err == nil {
+		t.Fatal("was expecting error")
+	}
+	if svc.attempts != 1 {
+		t.Fatalf("expected 1 attempt without retries, got %d", svc.attempts)
+	}
+}
+
+func TestOptionsApplyInOrder(t *testing.T) {
+	var started []string
+	c := gontainer.New(
+		gontainer.WithStartupRetry(5, time.Millisecond),
+		gontainer.WithOnServiceStarted(func(id string) { started = append(started, id) }),
+		gontainer.WithStartupRetry(2, time.Millisecond),
+	)
+	svc := &TypeFlakyService{failures: 1, err: errors.New("not yet")}
+	c.RegisterService("flaky", svc)
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", svc.attempts)
+	}
+	if !slices.Equal(started, []string{"flaky"}) {
+		t.Fatalf("expected the started hook to run, got %v", started)
+	}
+}
+
+type TypeUsingDependency struct {
+	Dep *TypeDependency `inject:"dep"`
+}
+
+func TestStrictUnused(t *testing.T) {
+	c := gontainer.New(gontainer.WithStrictUnused())
+	c.RegisterService("dep", &TypeDependency{})
+	c.RegisterService("svc", &TypeRecordingService{})
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+	const msg = "unused services: dep"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestStrictUnusedWithDependency(t *testing.T) {
+	c := gontainer.New(gontainer.WithStrictUnused())
+	c.RegisterService("dep", &TypeDependency{})
+	c.RegisterService("svc", &TypeUsingDependency{})
+	c.RegisterService("recording", &TypeRecordingService{})
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+	const msg = "unused services: svc"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeUsingDependencyService struct {
+	Dep *TypeDependency `inject:"dep"`
+}
+
+func (s *TypeUsingDependencyService) Startup() error  { return nil }
+func (s *TypeUsingDependencyService) Shutdown() error { return nil }
+
+func TestStrictUnusedSatisfied(t *testing.T) {
+	c := gontainer.New(gontainer.WithStrictUnused())
+	c.RegisterService("dep", &TypeDependency{})
+	c.RegisterService("svc", &TypeUsingDependencyService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type TypeContextStartupService struct {
+	dep interface{}
+}
+
+func (s *TypeContextStartupService) StartupContext(ctx context.Context) error {
+	c, ok := gontainer.FromContext(ctx)
+	if !ok {
+		return errors.New("no container in context")
+	}
+	s.dep = c.GetServiceOrNil("dep")
+	return nil
+}
+
+func (s *TypeContextStartupService) Startup() error  { return errors.New("unexpected Startup call") }
+func (s *TypeContextStartupService) Shutdown() error { return nil }
+
+func TestStartupContextCarriesContainer(t *testing.T) {
+	c := gontainer.New()
+	dep := &TypeDependency{}
+	svc := &TypeContextStartupService{}
+	c.RegisterService("dep", dep)
+	c.RegisterService("svc", svc)
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.dep != dep {
+		t.Fatalf("expected to fetch dep through the context container, got %v", svc.dep)
+	}
+}
+
+func TestFromContextWithoutContainer(t *testing.T) {
+	if _, ok := gontainer.FromContext(context.Background()); ok {
+		t.Fatal("expected no container in a plain context")
+	}
+}
+
+type TypeMissingDependencies struct {
+	A *TypeDependency `inject:"missing-a"`
+}
+
+type TypeOtherMissingDependencies struct {
+	B *TypeDependency `inject:"missing-b"`
+}
+
+type TypeMissingInterface struct {
+	S gontainer.Service `inject:""`
+}
+
+func TestValidateAll(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("a", &TypeMissingDependencies{})
+	c.RegisterService("b", &TypeOtherMissingDependencies{})
+	c.RegisterService("c", &TypeMissingInterface{})
+
+	err := c.ValidateAll()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+	for _, msg := range []string{
+		"did not find object named missing-a required by field A in type *gontainer_test.TypeMissingDependencies",
+		"did not find object named missing-b required by field B in type *gontainer_test.TypeOtherMissingDependencies",
+		"found no assignable value for field S in type *gontainer_test.TypeMissingInterface",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Fatalf("expected error to contain:\n%s\nactual:\n%s", msg, err.Error())
+		}
+	}
+}
+
+type TypeStartupConfiguredService struct {
+	Dep      *TypeDependency `inject:",force"`
+	custom   *TypeDependency
+	startups int
+}
+
+func (s *TypeStartupConfiguredService) Startup() error {
+	s.startups++
+	s.Dep = s.custom
+	return nil
+}
+
+func (s *TypeStartupConfiguredService) Shutdown() error { return nil }
+
+func TestReadyAgainLeavesStartedServicesUntouched(t *testing.T) {
+	c := gontainer.New(gontainer.WithPostReadyRegistration(gontainer.PostReadyAllow))
+	custom := &TypeDependency{}
+	first := &TypeStartupConfiguredService{custom: custom}
+	c.RegisterService("first", first)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	late := &TypeRecordingService{}
+	c.RegisterService("late", late)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Dep != custom {
+		t.Fatal("expected fields set during startup to be left untouched")
+	}
+	if first.startups != 1 {
+		t.Fatalf("expected first service to start once, got %d", first.startups)
+	}
+	if !late.started {
+		t.Fatal("expected late service to be started")
+	}
+}
+
+func TestRejectedPostReadyRegistrationKeepsReady(t *testing.T) {
+	c := gontainer.New(gontainer.WithPostReadyRegistration(gontainer.PostReadyAllow))
+	c.RegisterService("svc", &TypeRecordingService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.RegisterServiceObj("svc", &TypeRecordingService{}); err == nil {
+		t.Fatal("did not find expected error")
+	}
+	if _, err := c.RegisterServiceObj(gontainer.ServicesID, &TypeRecordingService{}); err == nil {
+		t.Fatal("did not find expected error")
+	}
+	if err := c.Reload("svc"); err != nil {
+		t.Fatalf("expected the container to stay ready, got %v", err)
+	}
+}
+
+func TestPostReadyRegistrationError(t *testing.T) {
+	c := gontainer.New()
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, gontainer.ErrRegisteredAfterReady) {
+			t.Fatalf("expected panic with ErrRegisteredAfterReady, got %v", err)
+		}
+		const msg = "failed to register service late: container is already ready"
+		if err.Error() != msg {
+			t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+		}
+	}()
+	c.RegisterService("late", &TypeRecordingService{})
+}
+
+func TestPostReadyRegistrationAllow(t *testing.T) {
+	c := gontainer.New(gontainer.WithPostReadyRegistration(gontainer.PostReadyAllow))
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	late := &TypeRecordingService{}
+	c.RegisterService("late", late)
+	if late.started {
+		t.Fatal("expected late service not to be started")
+	}
+	if c.GetServiceOrNil("late") != late {
+		t.Fatal("expected late service to be registered")
+	}
+}
+
+func TestPostReadyRegistrationAutoStart(t *testing.T) {
+	c := gontainer.New(gontainer.WithPostReadyRegistration(gontainer.PostReadyAutoStart))
+	c.RegisterService("dep", &TypeDependency{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	late := &TypeWiredService{}
+	c.RegisterService("late", late)
+	if !late.started {
+		t.Fatal("expected late service to be wired and started")
+	}
+}
+
+func TestWait(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeRecordingService{}
+	c.RegisterService("svc", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.Shutdown()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not unblock after Shutdown")
+	}
+	if !svc.stopped {
+		t.Fatal("expected Wait to return after the service was shut down")
+	}
+
+	// Waiting again after Shutdown returns immediately.
+	c.Wait()
+}
+
+func TestRegisterServiceIf(t *testing.T) {
+	c := gontainer.New()
+	enabled := &TypeRecordingService{}
+	disabled := &TypeRecordingService{}
+	c.RegisterServiceIf("enabled", enabled, func() bool { return true })
+	c.RegisterServiceIf("disabled", disabled, func() bool { return false })
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := c.IDs(); !reflect.DeepEqual(ids, []string{"enabled"}) {
+		t.Fatalf("expected only the enabled service, got %v", ids)
+	}
+	if c.GetServiceOrNil("enabled") != enabled || !enabled.started {
+		t.Fatal("expected enabled service to be registered and started")
+	}
+	if c.GetServiceOrNil("disabled") != nil {
+		t.Fatal("expected nil for the disabled service")
+	}
+	if disabled.started {
+		t.Fatal("expected disabled service not to be started")
+	}
+	for _, info := range c.Describe() {
+		if info.ID == "disabled" {
+			t.Fatal("expected disabled service to be absent from the graph")
+		}
+	}
+}
+
+type TypeValueConsumer struct {
+	Value   *TypeRecordingService `inject:""`
+	started bool
+}
+
+func (s *TypeValueConsumer) Startup() error  { s.started = true; return nil }
+func (s *TypeValueConsumer) Shutdown() error { return nil }
+
+func TestProvideValue(t *testing.T) {
+	c := gontainer.New()
+	value := &TypeRecordingService{}
+	c.ProvideValue(value)
+	consumer := &TypeValueConsumer{}
+	c.RegisterService("consumer", consumer)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if consumer.Value != value {
+		t.Fatal("expected the provided value to be injected")
+	}
+	if !consumer.started {
+		t.Fatal("expected the consumer to be started")
+	}
+	if value.started {
+		t.Fatal("expected the provided value not to be started")
+	}
+
+	c.Shutdown()
+	if value.stopped {
+		t.Fatal("expected the provided value not to be shut down")
+	}
+}
+
+func TestProvideValueDuplicatePanics(t *testing.T) {
+	c := gontainer.New()
+	c.ProvideValue(&TypeRecordingService{})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected providing a duplicate value to panic")
+		}
+	}()
+	c.ProvideValue(&TypeRecordingService{})
+}
+
+type spyGraph struct {
+	inject.Graph
+	provided  []string
+	populated int
+}
+
+func (g *spyGraph) Provide(objects ...*inject.Object) error {
+	for _, o := range objects {
+		g.provided = append(g.provided, o.Name)
+	}
+	return g.Graph.Provide(objects...)
+}
+
+func (g *spyGraph) Populate() error {
+	g.populated++
+	return g.Graph.Populate()
+}
+
+func TestNewWithGraph(t *testing.T) {
+	g := &spyGraph{}
+	c := gontainer.NewWithGraph(g)
+	svc := &TypeWiredService{}
+	c.RegisterService("a", svc)
+	c.RegisterService("b", &TypeRecordingService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(g.provided, []string{"a", "b"}) {
+		t.Fatalf("expected services a and b to be provided, got %v", g.provided)
+	}
+	if g.populated != 1 {
+		t.Fatalf("expected the graph to be populated once, got %d", g.populated)
+	}
+	if !svc.started {
+		t.Fatal("expected the service to be wired and started")
+	}
+}
+
+func TestRegisterAll(t *testing.T) {
+	c := gontainer.New()
+	err := c.RegisterAll(map[string]interface{}{
+		"c": &TypeRecordingService{},
+		"a": &TypeRecordingService{},
+		"b": &TypeRecordingService{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "b", "c"}
+	if actual := c.IDs(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestRegisterAllDuplicate(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("b", &TypeRecordingService{})
+	err := c.RegisterAll(map[string]interface{}{
+		"a": &TypeRecordingService{},
+		"b": &TypeRecordingService{},
+		"c": &TypeRecordingService{},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the duplicate id")
+	}
+
+	const msg = "failed to register service b: provided two instances named b"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	expected := []string{"b", "a", "c"}
+	if actual := c.IDs(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestMustRegisterAllPanics(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("a", &TypeRecordingService{})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected MustRegisterAll to panic")
+		}
+	}()
+	gontainer.MustRegisterAll(c, map[string]interface{}{"a": &TypeRecordingService{}})
+}
+
+type TypeSelfNamedService struct {
+	ID string `inject:"self:name"`
+}
+
+func TestServiceReceivesOwnID(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeSelfNamedService{}
+	c.RegisterService("orders", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.ID != "orders" {
+		t.Fatalf("expected the service to receive its id, got %q", svc.ID)
+	}
+}
+
+type TypeCountingService struct {
+	startups  int
+	shutdowns int
+}
+
+func (s *TypeCountingService) Startup() error  { s.startups++; return nil }
+func (s *TypeCountingService) Shutdown() error { s.shutdowns++; return nil }
+
+func TestShutdownTwice(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeCountingService{}
+	c.RegisterService("svc", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Shutdown()
+	c.Shutdown()
+	if svc.shutdowns != 1 {
+		t.Fatalf("expected one shutdown, got %d", svc.shutdowns)
+	}
+}
+
+func TestReadyAfterShutdownRestarts(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeCountingService{}
+	c.RegisterService("svc", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.startups != 2 {
+		t.Fatalf("expected the service to be started again, got %d startups", svc.startups)
+	}
+	c.Shutdown()
+	if svc.shutdowns != 2 {
+		t.Fatalf("expected the service to be shut down again, got %d shutdowns", svc.shutdowns)
+	}
+}
+
+type TypeGreeter interface {
+	Greet() string
+}
+
+type TypeEnglishGreeter struct{}
+
+func (g *TypeEnglishGreeter) Greet() string { return "hello" }
+
+type TypeGreetingService struct {
+	Greeter TypeGreeter `inject:""`
+}
+
+func TestRegisteredServiceSatisfiesInterface(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeGreetingService{}
+	c.RegisterService("greeter", &TypeEnglishGreeter{})
+	c.RegisterService("greeting", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Greeter == nil || svc.Greeter.Greet() != "hello" {
+		t.Fatal("expected the registered greeter to be injected")
+	}
+}
+
+func TestMissingInterfaceListsServices(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("greeting", &TypeGreetingService{})
+	c.RegisterService("recording", &TypeRecordingService{})
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to populate graph: found no assignable value for field Greeter in type " +
+		"*gontainer_test.TypeGreetingService (available: recording (*gontainer_test.TypeRecordingService), " +
+		"none implement gontainer_test.TypeGreeter)"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeNamedGreeter struct {
+	name string
+}
+
+func (g *TypeNamedGreeter) Greet() string { return g.name }
+
+type TypeGreetersService struct {
+	Greeters []TypeGreeter `inject:""`
+}
+
+func TestRegisteredServicesCollected(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeGreetersService{}
+	zeta, alpha := &TypeNamedGreeter{name: "zeta"}, &TypeNamedGreeter{name: "alpha"}
+	c.RegisterService("zeta", zeta)
+	c.RegisterService("greeters", svc)
+	c.RegisterService("alpha", alpha)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Greeters) != 2 || svc.Greeters[0] != zeta || svc.Greeters[1] != alpha {
+		t.Fatalf("expected the registered greeters in registration order, got %v", svc.Greeters)
+	}
+}
+
+type TypeHealthCheck struct {
+	err   error
+	block chan struct{}
+}
+
+func (s *TypeHealthCheck) HealthCheck(ctx context.Context) error {
+	if s.block != nil {
+		<-s.block
+	}
+	return s.err
+}
+
+func TestHealthTimeout(t *testing.T) {
+	c := gontainer.New(gontainer.WithHealthTimeout(10 * time.Millisecond))
+	blocking := &TypeHealthCheck{block: make(chan struct{})}
+	defer close(blocking.block)
+	failing := &TypeHealthCheck{err: errors.New("unreachable")}
+	c.RegisterService("blocking", blocking)
+	c.RegisterService("failing", failing)
+	c.RegisterService("healthy", &TypeHealthCheck{})
+	c.RegisterService("recording", &TypeRecordingService{})
+
+	results := c.Health(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("expected three results, got %v", results)
+	}
+	if !errors.Is(results["blocking"], context.DeadlineExceeded) {
+		t.Fatalf("expected blocking check to time out, got %v", results["blocking"])
+	}
+	if results["failing"] == nil || results["failing"].Error() != "unreachable" {
+		t.Fatalf("expected failing check to report its error, got %v", results["failing"])
+	}
+	if err, ok := results["healthy"]; !ok || err != nil {
+		t.Fatalf("expected healthy check to report nil, got %v", err)
+	}
+}
+
+func TestServiceHealthTimeout(t *testing.T) {
+	c := gontainer.New(gontainer.WithServiceHealthTimeout("blocking", 10*time.Millisecond))
+	blocking := &TypeHealthCheck{block: make(chan struct{})}
+	defer close(blocking.block)
+	c.RegisterService("blocking", blocking)
+
+	done := make(chan map[string]error)
+	go func() { done <- c.Health(context.Background()) }()
+
+	select {
+	case results := <-done:
+		if !errors.Is(results["blocking"], context.DeadlineExceeded) {
+			t.Fatalf("expected blocking check to time out, got %v", results["blocking"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Health hung on a blocking check")
+	}
+}
+
+type TypeConcurrentHealthCheck struct {
+	mu     sync.Mutex
+	active int
+	max    int
+}
+
+func (s *TypeConcurrentHealthCheck) HealthCheck(ctx context.Context) error {
+	s.mu.Lock()
+	s.active++
+	s.max = max(s.max, s.active)
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	return nil
+}
+
+func TestMaxParallelHealth(t *testing.T) {
+	c := gontainer.New(gontainer.WithMaxParallelHealth(2))
+	check := &TypeConcurrentHealthCheck{}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		c.RegisterService(id, check)
+	}
+
+	if results := c.Health(context.Background()); len(results) != 5 {
+		t.Fatalf("expected five results, got %v", results)
+	}
+	if check.max > 2 {
+		t.Fatalf("expected at most two concurrent checks, got %d", check.max)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c := gontainer.New()
+	a := &TypeRecordingService{}
+	b := &TypeWiredService{}
+	c.RegisterService("a", a)
+	c.RegisterService("b", b)
+
+	snapshot := c.Snapshot()
+	expected := map[string]interface{}{"a": a, "b": b}
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Fatalf("expected %v, got %v", expected, snapshot)
+	}
+
+	delete(snapshot, "a")
+	snapshot["c"] = &TypeRecordingService{}
+	if actual := c.Snapshot(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected mutating the snapshot to leave the container alone, got %v", actual)
+	}
+}
+
+type TypeConstructedDependency struct {
+	Name string
+}
+
+type TypeConstructedService struct {
+	Dep *TypeConstructedDependency `inject:""`
+}
+
+func TestWithConstructor(t *testing.T) {
+	c := gontainer.New(gontainer.WithConstructor(
+		reflect.TypeOf(&TypeConstructedDependency{}),
+		func() interface{} { return &TypeConstructedDependency{Name: "constructed"} },
+	))
+	svc := &TypeConstructedService{}
+	c.RegisterService("svc", svc)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Dep == nil || svc.Dep.Name != "constructed" {
+		t.Fatalf("expected the dependency to be built by its constructor, got %+v", svc.Dep)
+	}
+}
+
+type TypeScopedService struct {
+	Dep     *TypeDependency       `inject:""`
+	Wired   *TypeWiredService     `inject:"wired"`
+	Request *TypeRecordingService `inject:"request"`
+}
+
+func TestScope(t *testing.T) {
+	parent := gontainer.New()
+	wired := &TypeWiredService{}
+	parent.RegisterService("wired", wired)
+	if err := parent.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	child := parent.Scope()
+	request := &TypeRecordingService{}
+	scoped := &TypeScopedService{}
+	child.RegisterService("request", request)
+	child.RegisterService("scoped", scoped)
+	if err := child.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if scoped.Wired != wired || scoped.Dep != wired.Dep || scoped.Request != request {
+		t.Fatal("expected the scoped service to be wired with parent and scope-local services")
+	}
+	if child.GetServiceOrNil("wired") != wired {
+		t.Fatal("expected lookups to fall through to the parent")
+	}
+	if !reflect.DeepEqual(parent.IDs(), []string{"wired"}) {
+		t.Fatalf("expected scope-local services not to leak to the parent, got %v", parent.IDs())
+	}
+
+	child.Shutdown()
+	if !request.stopped {
+		t.Fatal("expected the scope-local service to be shut down")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected the parent not to find scope-local services")
+		}
+	}()
+	parent.GetServiceOrNil("request")
+}
+
+func TestScopeShutdownLeavesParentServices(t *testing.T) {
+	parent := gontainer.New()
+	svc := &TypeCountingService{}
+	parent.RegisterService("svc", svc)
+	if err := parent.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	child := parent.Scope()
+	child.RegisterService("local", &TypeRecordingService{})
+	if err := child.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	child.Shutdown()
+
+	if svc.startups != 1 || svc.shutdowns != 0 {
+		t.Fatalf("expected the parent service to be left alone, got %d startups and %d shutdowns", svc.startups, svc.shutdowns)
+	}
+}
+
+type TypeSlowStartupService struct {
+	delay time.Duration
+}
+
+func (s *TypeSlowStartupService) Startup() error  { time.Sleep(s.delay); return nil }
+func (s *TypeSlowStartupService) Shutdown() error { return nil }
+
+func TestStartupWatchdog(t *testing.T) {
+	stuck := make(chan string, 2)
+	c := gontainer.New(gontainer.WithStartupWatchdog(10*time.Millisecond, func(id string) {
+		stuck <- id
+	}))
+	c.RegisterService("fast", &TypeSlowStartupService{})
+	c.RegisterService("slow", &TypeSlowStartupService{delay: 50 * time.Millisecond})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-stuck:
+		if id != "slow" {
+			t.Fatalf("expected the slow service to be reported, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the slow service to be reported")
+	}
+	select {
+	case id := <-stuck:
+		t.Fatalf("expected only the slow service to be reported, got %s too", id)
+	default:
+	}
+}
+
+func TestGetByType(t *testing.T) {
+	c := gontainer.New()
+	wired := &TypeWiredService{}
+	c.RegisterService("wired", wired)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := c.GetByType(reflect.TypeOf(&TypeWiredService{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != wired {
+		t.Fatal("expected the registered service")
+	}
+
+	dep, err := gontainer.GetType[*TypeDependency](c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dep != wired.Dep {
+		t.Fatal("expected the created dependency")
+	}
+}
+
+func TestGetByTypeNoMatch(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("svc", &TypeRecordingService{})
+
+	_, err := gontainer.GetType[TypeGreeter](c)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "no service of type gontainer_test.TypeGreeter found"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestGetByTypeMultipleMatches(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("b", &TypeRecordingService{})
+	c.RegisterService("a", &TypeRecordingService{})
+
+	_, err := gontainer.GetType[gontainer.Service](c)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "found 2 services of type gontainer.Service: a, b"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeCloser struct {
+	closed bool
+}
+
+func (s *TypeCloser) Close() error { s.closed = true; return nil }
+
+type TypeCloserService struct {
+	TypeRecordingService
+	closed bool
+}
+
+func (s *TypeCloserService) Close() error { s.closed = true; return nil }
+
+func TestShutdownClosesClosers(t *testing.T) {
+	c := gontainer.New()
+	closer := &TypeCloser{}
+	both := &TypeCloserService{}
+	c.RegisterService("closer", closer)
+	c.RegisterService("both", both)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Shutdown()
+	if !closer.closed {
+		t.Fatal("expected the closer to be closed")
+	}
+	if !both.stopped || both.closed {
+		t.Fatal("expected Shutdown to be preferred over Close")
+	}
+}
+
+type TypeOrderRecorder struct {
+	started []string
+}
+
+type TypeOrderedService struct {
+	id       string
+	recorder *TypeOrderRecorder
+}
+
+func (s *TypeOrderedService) Startup() error {
+	s.recorder.started = append(s.recorder.started, s.id)
+	return nil
+}
+func (s *TypeOrderedService) Shutdown() error { return nil }
+
+type TypeOrderedConsumer struct {
+	TypeOrderedService
+	DB *TypeOrderedService `inject:"db"`
+}
+
+func TestStartupFollowsDependencies(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	c := gontainer.New()
+	c.RegisterService("api", &TypeOrderedConsumer{TypeOrderedService: TypeOrderedService{id: "api", recorder: recorder}})
+	c.RegisterService("db", &TypeOrderedService{id: "db", recorder: recorder})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"db", "api"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+}
+
+func TestStartupPriorities(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	service := func(id string) *TypeOrderedService {
+		return &TypeOrderedService{id: id, recorder: recorder}
+	}
+	c := gontainer.New()
+	c.RegisterService("api", &TypeOrderedConsumer{TypeOrderedService: *service("api")})
+	c.RegisterService("cache", service("cache"))
+	c.RegisterServiceWithPriority("metrics", -10, service("metrics"))
+	c.RegisterServiceWithPriority("db", 10, service("db"))
+	c.RegisterServiceWithPriority("tail", 100, service("tail"))
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	// api has the default priority but must wait for db.
+	expected := []string{"metrics", "cache", "db", "api", "tail"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+}
+
+func TestLifecycleCallbacks(t *testing.T) {
+	var events []string
+	c := gontainer.New(
+		gontainer.WithShutdownTimeout(10*time.Millisecond),
+		gontainer.WithOnServiceStarted(func(id string) { events = append(events, "started "+id) }),
+		gontainer.WithOnServiceStopped(func(id string) { events = append(events, "stopped "+id) }),
+	)
+	c.RegisterService("a", &TypeRecordingService{})
+	c.RegisterService("stuck", &TypeContextShutdownService{errs: make(chan error, 1)})
+	c.RegisterService("dep", &TypeDependency{})
+	c.RegisterService("b", &TypeCloser{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+
+	expected := []string{
+		"started a",
+		"started stuck",
+		"stopped b",
+		"stopped a",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+}
+
+type TypePanickingService struct {
+	onStartup  bool
+	onShutdown bool
+}
+
+func (s *TypePanickingService) Startup() error {
+	if s.onStartup {
+		panic("boom")
+	}
+	return nil
+}
+
+func (s *TypePanickingService) Shutdown() error {
+	if s.onShutdown {
+		panic("boom")
+	}
+	return nil
+}
+
+func TestStartupPanicIsRecovered(t *testing.T) {
+	c := gontainer.New()
+	first := &TypeRecordingService{}
+	c.RegisterService("first", first)
+	c.RegisterService("panicking", &TypePanickingService{onStartup: true})
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const prefix = "failed to start service panicking: service panicking panicked during startup: boom\n"
+	if !strings.HasPrefix(err.Error(), prefix) {
+		t.Fatalf("expected prefix:\n%s\nactual:\n%s", prefix, err.Error())
+	}
+	if !first.stopped {
+		t.Fatal("expected the started service to be rolled back")
+	}
+}
+
+type TypeFailingCountingService struct {
+	shutdowns int
+}
+
+func (s *TypeFailingCountingService) Startup() error  { return errors.New("boom") }
+func (s *TypeFailingCountingService) Shutdown() error { s.shutdowns++; return nil }
+
+func TestShutdownAfterFailedReady(t *testing.T) {
+	c := gontainer.New()
+	a := &TypeCountingService{}
+	b := &TypeFailingCountingService{}
+	c.RegisterService("a", a)
+	c.RegisterService("b", b)
+
+	if err := c.Ready(); err == nil {
+		t.Fatal("did not find expected error")
+	}
+	c.Shutdown()
+	if a.shutdowns != 1 {
+		t.Fatalf("expected the rolled back service to be shut down once, got %d shutdowns", a.shutdowns)
+	}
+	if b.shutdowns != 0 {
+		t.Fatalf("expected the failed service not to be shut down, got %d shutdowns", b.shutdowns)
+	}
+}
+
+func TestShutdownPanicIsRecovered(t *testing.T) {
+	c := gontainer.New()
+	next := &TypeRecordingService{}
+	c.RegisterService("next", next)
+	c.RegisterService("panicking", &TypePanickingService{onShutdown: true})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Shutdown()
+	if !next.stopped {
+		t.Fatal("expected teardown to continue past the panicking service")
+	}
+}
+
+func TestRecoverPanicsDisabled(t *testing.T) {
+	c := gontainer.New(gontainer.WithRecoverPanics(false))
+	c.RegisterService("panicking", &TypePanickingService{onStartup: true})
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected the panic to propagate, got %v", r)
+		}
+	}()
+	c.Ready()
+}
+
+func TestReadyWithProgress(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("a", &TypeRecordingService{})
+	c.RegisterService("b", &TypeRecordingService{})
+	c.RegisterService("dependency", &TypeDependency{})
+
+	ch := make(chan gontainer.Progress, 8)
+	if err := c.ReadyWithProgress(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	var started []string
+	for p := range ch {
+		if p.Total != 2 {
+			t.Fatalf("expected a total of 2, got %d", p.Total)
+		}
+		if p.Phase == "started" {
+			started = append(started, p.ID)
+			if p.Index != len(started) {
+				t.Fatalf("expected %s to have index %d, got %d", p.ID, len(started), p.Index)
+			}
+		}
+	}
+	if !reflect.DeepEqual(started, []string{"a", "b"}) {
+		t.Fatalf("expected a and b to be reported, got %v", started)
+	}
+}
+
+func TestReadyWithProgressDoesNotBlock(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("a", &TypeRecordingService{})
+	c.RegisterService("b", &TypeRecordingService{})
+
+	ch := make(chan gontainer.Progress)
+	if err := c.ReadyWithProgress(ch); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("expected the channel to be closed")
+	}
+}
+
+func TestReadyWithProgressNilChannel(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeRecordingService{}
+	c.RegisterService("svc", svc)
+
+	if err := c.ReadyWithProgress(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !svc.started {
+		t.Fatal("expected service to be started")
+	}
+}
+
+func TestReadyWithProgressReportsFailure(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("failing", &TypeFailingService{})
+
+	ch := make(chan gontainer.Progress, 8)
+	if err := c.ReadyWithProgress(ch); err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	var phases []string
+	for p := range ch {
+		phases = append(phases, p.Phase)
+	}
+	if !reflect.DeepEqual(phases, []string{"starting", "failed"}) {
+		t.Fatalf("expected starting then failed, got %v", phases)
+	}
+}
+
+type TypeRepoConsumer struct {
+	Primary *TypeConstructedDependency `inject:""`
+}
+
+func TestWithFieldNames(t *testing.T) {
+	c := gontainer.New(gontainer.WithFieldNames())
+	primary := &TypeConstructedDependency{Name: "primary"}
+	c.RegisterService("Primary", primary)
+	c.RegisterService("consumer", &TypeRepoConsumer{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.GetServiceOrNil("consumer").(*TypeRepoConsumer).Primary != primary {
+		t.Fatal("expected the service named after the field")
+	}
+}
+
+func TestReadyOnceCachesError(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeFlakyService{failures: 1, err: errors.New("not yet")}
+	c.RegisterService("flaky", svc)
+
+	first := c.ReadyOnce()
+	if first == nil {
+		t.Fatal("did not find expected error")
+	}
+	if second := c.ReadyOnce(); second != first {
+		t.Fatalf("expected the cached error, got %v", second)
+	}
+	if svc.attempts != 1 {
+		t.Fatalf("expected startup to be attempted once, got %d", svc.attempts)
+	}
+
+	c.Reset()
+	if err := c.ReadyOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.attempts != 2 {
+		t.Fatalf("expected startup to be retried after Reset, got %d attempts", svc.attempts)
+	}
+}
+
+func TestReadyOnceConcurrent(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeCountingService{}
+	c.RegisterService("svc", svc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.ReadyOnce(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if svc.startups != 1 {
+		t.Fatalf("expected one startup, got %d", svc.startups)
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	service := func(id string) *TypeOrderedService {
+		return &TypeOrderedService{id: id, recorder: recorder}
+	}
+	c := gontainer.New()
+	c.RegisterService("api", service("api"))
+	c.RegisterService("cache", service("cache"))
+	c.RegisterService("db", service("db"))
+	c.DependsOn("api", "cache", "db")
+	c.DependsOn("cache", "db")
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"db", "cache", "api"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+}
+
+func TestDependsOnUnknownService(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("api", &TypeRecordingService{})
+	c.DependsOn("api", "db")
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "service api depends on unknown service db"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestDependsOnCycle(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("a", &TypeRecordingService{})
+	c.RegisterService("b", &TypeRecordingService{})
+	c.RegisterService("c", &TypeRecordingService{})
+	c.DependsOn("a", "b")
+	c.DependsOn("b", "c")
+	c.DependsOn("c", "a")
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "dependency cycle: a -> b -> c -> a"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestRegisterServiceObj(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeWiredService{}
+	obj, err := c.RegisterServiceObj("wired", svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Name != "wired" || obj.Value != svc {
+		t.Fatalf("expected the registered object, got %s", obj)
+	}
+
+	// A complete object is left alone by populate.
+	obj.Complete = true
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Dep != nil {
+		t.Fatal("expected the complete service not to be wired")
+	}
+}
+
+func TestRegisterServiceObjDuplicate(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("svc", &TypeRecordingService{})
+
+	obj, err := c.RegisterServiceObj("svc", &TypeRecordingService{})
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	if obj != nil {
+		t.Fatal("expected no object for a failed registration")
+	}
+	const msg = "failed to register service svc: provided two instances named svc"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeConfigurableService struct {
+	TypeOrderedService
+	DB *TypeOrderedService `inject:"db"`
+}
+
+func (s *TypeConfigurableService) Configure() error {
+	s.recorder.started = append(s.recorder.started, "configure "+s.id)
+	return nil
+}
+
+func TestConfigureBeforeStartup(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	configurable := func(id string) *TypeConfigurableService {
+		return &TypeConfigurableService{TypeOrderedService: TypeOrderedService{id: id, recorder: recorder}}
+	}
+	c := gontainer.New()
+	c.RegisterService("api", configurable("api"))
+	c.RegisterService("db", &TypeOrderedService{id: "db", recorder: recorder})
+	c.RegisterService("worker", configurable("worker"))
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"configure api", "configure worker", "db", "api", "worker"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+}
+
+func TestReadyAfterShutdownConfiguresAgain(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	c := gontainer.New()
+	c.RegisterService("db", &TypeOrderedService{id: "db", recorder: recorder})
+	c.RegisterService("api", &TypeConfigurableService{TypeOrderedService: TypeOrderedService{id: "api", recorder: recorder}})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"configure api", "db", "api", "configure api", "db", "api"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+}
+
+type TypeFailingConfigurable struct {
+	TypeRecordingService
+}
+
+func (s *TypeFailingConfigurable) Configure() error { return errors.New("bad config") }
+
+func TestConfigureFailure(t *testing.T) {
+	c := gontainer.New()
+	svc := &TypeRecordingService{}
+	c.RegisterService("svc", svc)
+	c.RegisterService("failing", &TypeFailingConfigurable{})
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to configure service failing: bad config"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	if svc.started {
+		t.Fatal("expected no service to start after a failed Configure")
+	}
+}
+
+type TypeRecordingLogger struct {
+	id    string
+	lines *[]string
+}
+
+func (l *TypeRecordingLogger) Printf(format string, v ...interface{}) {
+	*l.lines = append(*l.lines, l.id+": "+fmt.Sprintf(format, v...))
+}
+
+func (l *TypeRecordingLogger) With(id string) gontainer.Logger {
+	return &TypeRecordingLogger{id: id, lines: l.lines}
+}
+
+type TypeLoggingService struct {
+	Log gontainer.Logger `inject:""`
+}
+
+func TestWithLogger(t *testing.T) {
+	var lines []string
+	c := gontainer.New(gontainer.WithLogger(&TypeRecordingLogger{id: "root", lines: &lines}))
+	c.RegisterService("users", &TypeLoggingService{})
+	c.RegisterService("orders", &TypeLoggingService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.GetServiceOrNil("users").(*TypeLoggingService).Log.Printf("hello")
+	c.GetServiceOrNil("orders").(*TypeLoggingService).Log.Printf("hello")
+	expected := []string{"users: hello", "orders: hello"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected %v, got %v", expected, lines)
+	}
+}
+
+type TypeAuditService struct {
+	Log gontainer.Logger `inject:"audit"`
+}
+
+func TestWithLoggerLeavesNamedLoggers(t *testing.T) {
+	var lines []string
+	audit := &TypeRecordingLogger{id: "audit", lines: &lines}
+	c := gontainer.New(gontainer.WithLogger(&TypeRecordingLogger{id: "root", lines: &lines}))
+	c.RegisterService("audit", audit)
+	c.RegisterService("users", &TypeAuditService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.GetServiceOrNil("users").(*TypeAuditService).Log != audit {
+		t.Fatal("expected the logger registered under the tag's name")
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf strings.Builder
+	logger := gontainer.NewLogger(log.New(&buf, "", 0))
+	logger.With("users").With("db").Printf("connected to %s", "primary")
+
+	const expected = "[users] [db] connected to primary\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestOnReadyRunsLast(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	c := gontainer.New(gontainer.WithOnReady(func() error {
+		recorder.started = append(recorder.started, "ready")
+		return nil
+	}))
+	c.RegisterService("a", &TypeOrderedService{id: "a", recorder: recorder})
+	c.RegisterService("b", &TypeOrderedService{id: "b", recorder: recorder})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "b", "ready"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+}
+
+func TestOnReadyFailureRollsBack(t *testing.T) {
+	c := gontainer.New(gontainer.WithOnReady(func() error {
+		return errors.New("discovery unavailable")
+	}))
+	svc := &TypeRecordingService{}
+	c.RegisterService("svc", svc)
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "ready hook failed: discovery unavailable"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	if !svc.stopped {
+		t.Fatal("expected the started service to be shut down")
+	}
+}
+
+func TestNonCriticalServiceFailure(t *testing.T) {
+	c := gontainer.New()
+	first := &TypeRecordingService{}
+	last := &TypeRecordingService{}
+	c.RegisterService("first", first)
+	c.RegisterServiceCritical("optional", false, &TypeFailingService{})
+	c.RegisterService("last", last)
+
+	err := c.Ready()
+	var degraded *gontainer.DegradedError
+	if !errors.As(err, &degraded) {
+		t.Fatalf("expected a degraded error, got %v", err)
+	}
+	const msg = "non-critical services failed to start: optional: boom"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	if !first.started || !last.started || first.stopped {
+		t.Fatal("expected the other services to start and stay up")
+	}
+
+	// The container is ready despite the failure.
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFailedNonCriticalServiceIsNotShutDown(t *testing.T) {
+	c := gontainer.New()
+	first := &TypeRecordingService{}
+	optional := &TypeFailingCountingService{}
+	c.RegisterService("first", first)
+	c.RegisterServiceCritical("optional", false, optional)
+
+	var degraded *gontainer.DegradedError
+	if err := c.Ready(); !errors.As(err, &degraded) {
+		t.Fatalf("expected a degraded error, got %v", err)
+	}
+	c.Shutdown()
+	if !first.stopped {
+		t.Fatal("expected the started service to be shut down")
+	}
+	if optional.shutdowns != 0 {
+		t.Fatalf("expected the failed service never to be shut down, got %d shutdowns", optional.shutdowns)
+	}
+}
+
+func TestCriticalServiceFailure(t *testing.T) {
+	c := gontainer.New()
+	first := &TypeRecordingService{}
+	c.RegisterService("first", first)
+	c.RegisterServiceCritical("critical", true, &TypeFailingService{})
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to start service critical: boom"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	if !first.stopped {
+		t.Fatal("expected the started service to be rolled back")
+	}
+}
+
+type TypeConstructedConsumer struct {
+	Dep *TypeConstructedDependency `inject:"dep"`
+}
+
+func TestReplaceServiceBeforeReady(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("dep", &TypeConstructedDependency{Name: "old"})
+	c.RegisterService("consumer", &TypeConstructedConsumer{})
+
+	// Wire the graph before replacing, as ValidateAll does.
+	if err := c.ValidateAll(); err != nil {
+		t.Fatal(err)
+	}
+	replacement := &TypeConstructedDependency{Name: "new"}
+	if err := c.ReplaceService("dep", replacement); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.GetServiceOrNil("dep") != replacement {
+		t.Fatal("expected the replacement to be registered")
+	}
+	if c.GetServiceOrNil("consumer").(*TypeConstructedConsumer).Dep != replacement {
+		t.Fatal("expected the dependent to be wired to the replacement")
+	}
+}
+
+func TestReplaceServiceAfterReady(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("dep", &TypeConstructedDependency{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.ReplaceService("dep", &TypeConstructedDependency{})
+	if !errors.Is(err, gontainer.ErrRegisteredAfterReady) {
+		t.Fatalf("expected ErrRegisteredAfterReady, got %v", err)
+	}
+}
+
+type TypeFactoryBuilt struct {
+	Dep *TypeConstructedDependency `inject:""`
+}
+
+func TestMarkComplete(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("built", &TypeFactoryBuilt{})
+	c.RegisterService("wired", &TypeFactoryBuilt{})
+	if err := c.MarkComplete("built"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.GetServiceOrNil("built").(*TypeFactoryBuilt).Dep != nil {
+		t.Fatal("expected the complete service to be left alone")
+	}
+	if c.GetServiceOrNil("wired").(*TypeFactoryBuilt).Dep == nil {
+		t.Fatal("expected the other service to be wired")
+	}
+}
+
+func TestMarkCompleteErrors(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("svc", &TypeFactoryBuilt{})
+
+	err := c.MarkComplete("missing")
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to mark service missing complete: service not found"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MarkComplete("svc"); !errors.Is(err, gontainer.ErrRegisteredAfterReady) {
+		t.Fatalf("expected ErrRegisteredAfterReady, got %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	recorder := &TypeOrderRecorder{}
+	module := new(inject.Graph)
+	shared := &TypeConstructedDependency{Name: "shared"}
+	err := module.Provide(
+		&inject.Object{Value: &TypeOrderedService{id: "db", recorder: recorder}, Name: "db"},
+		&inject.Object{Value: &TypeOrderedService{id: "cache", recorder: recorder}, Name: "cache"},
+		&inject.Object{Value: shared},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := gontainer.New()
+	c.RegisterService("api", &TypeOrderedConsumer{TypeOrderedService: TypeOrderedService{id: "api", recorder: recorder}})
+	c.RegisterService("worker", &TypeOrderedService{id: "worker", recorder: recorder})
+	c.RegisterService("consumer", &TypeConstructedService{})
+	if err := c.Import(module); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	// api waits for the imported db, which otherwise start after the others.
+	expected := []string{"worker", "cache", "db", "api"}
+	if !reflect.DeepEqual(recorder.started, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.started)
+	}
+	if c.GetServiceOrNil("consumer").(*TypeConstructedService).Dep != shared {
+		t.Fatal("expected the imported unnamed object to be injected")
+	}
+}
+
+func TestImportCollision(t *testing.T) {
+	module := new(inject.Graph)
+	err := module.Provide(
+		&inject.Object{Value: &TypeRecordingService{}, Name: "svc"},
+		&inject.Object{Value: &TypeConstructedDependency{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := gontainer.New()
+	c.RegisterService("svc", &TypeRecordingService{})
+	c.ProvideValue(&TypeConstructedDependency{})
+
+	err = c.Import(module)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to import graph: an unnamed object of type *gontainer_test.TypeConstructedDependency is already provided\nservice svc is already registered"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeDispatcher struct {
+	All map[string]interface{} `inject:"services"`
+}
+
+func TestInjectServicesMap(t *testing.T) {
+	c := gontainer.New()
+	recording := &TypeRecordingService{}
+	dispatcher := &TypeDispatcher{}
+	c.RegisterService("recording", recording)
+	c.RegisterService("dispatcher", dispatcher)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"recording": recording, "dispatcher": dispatcher}
+	if !reflect.DeepEqual(dispatcher.All, expected) {
+		t.Fatalf("expected %v, got %v", expected, dispatcher.All)
+	}
+
+	// The map is a copy, so changing it leaves the container alone.
+	delete(dispatcher.All, "recording")
+	if c.GetServiceOrNil("recording") != recording {
+		t.Fatal("expected the container to keep the service")
+	}
+	if !reflect.DeepEqual(c.IDs(), []string{"recording", "dispatcher"}) {
+		t.Fatalf("expected the snapshot not to be registered, got %v", c.IDs())
+	}
+}
+
+func TestInjectServicesMapInScope(t *testing.T) {
+	c := gontainer.New()
+	recording := &TypeRecordingService{}
+	c.RegisterService("recording", recording)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	scope := c.Scope()
+	dispatcher := &TypeDispatcher{}
+	scope.RegisterService("dispatcher", dispatcher)
+	if err := scope.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"recording": recording, "dispatcher": dispatcher}
+	if !reflect.DeepEqual(dispatcher.All, expected) {
+		t.Fatalf("expected %v, got %v", expected, dispatcher.All)
+	}
+}
+
+func TestRegisterReservedServicesID(t *testing.T) {
+	c := gontainer.New()
+	_, err := c.RegisterServiceObj(gontainer.ServicesID, &TypeRecordingService{})
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to register service services: the id is reserved"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeBarrierShutdownService struct {
+	id      string
+	arrived chan<- string
+	release <-chan struct{}
+}
+
+func (s *TypeBarrierShutdownService) Startup() error { return nil }
+func (s *TypeBarrierShutdownService) Shutdown() error {
+	s.arrived <- s.id
+	<-s.release
+	return nil
+}
+
+func TestParallelShutdownWithinLevel(t *testing.T) {
+	arrived := make(chan string, 2)
+	release := make(chan struct{})
+	c := gontainer.New(gontainer.WithMaxParallelShutdown(2))
+	c.RegisterService("a", &TypeBarrierShutdownService{id: "a", arrived: arrived, release: release})
+	c.RegisterService("b", &TypeBarrierShutdownService{id: "b", arrived: arrived, release: release})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	go c.Shutdown()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-arrived:
+		case <-time.After(time.Second):
+			t.Fatal("expected independent services to shut down concurrently")
+		}
+	}
+	close(release)
+	c.Wait()
+}
+
+type TypeStopRecorder struct {
+	mu      sync.Mutex
+	stopped []string
+}
+
+type TypeStopRecordingService struct {
+	id       string
+	recorder *TypeStopRecorder
+}
+
+func (s *TypeStopRecordingService) Startup() error { return nil }
+func (s *TypeStopRecordingService) Shutdown() error {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.stopped = append(s.recorder.stopped, s.id)
+	return nil
+}
+
+type TypeStopRecordingConsumer struct {
+	TypeStopRecordingService
+	DB *TypeStopRecordingService `inject:"db"`
+}
+
+func TestParallelShutdownReversesLevels(t *testing.T) {
+	recorder := &TypeStopRecorder{}
+	service := func(id string) TypeStopRecordingService {
+		return TypeStopRecordingService{id: id, recorder: recorder}
+	}
+	db, cache := service("db"), service("cache")
+	c := gontainer.New(gontainer.WithMaxParallelShutdown(4))
+	c.RegisterService("db", &db)
+	c.RegisterService("api", &TypeStopRecordingConsumer{TypeStopRecordingService: service("api")})
+	c.RegisterService("cache", &cache)
+	c.RegisterService("admin", &TypeStopRecordingConsumer{TypeStopRecordingService: service("admin")})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+
+	// api and admin depend on db, so they stop first, in either order.
+	first, last := recorder.stopped[:2], recorder.stopped[2:]
+	slices.Sort(first)
+	slices.Sort(last)
+	if !reflect.DeepEqual(first, []string{"admin", "api"}) || !reflect.DeepEqual(last, []string{"cache", "db"}) {
+		t.Fatalf("expected api and admin to stop before cache and db, got %v", recorder.stopped)
+	}
+}
+
+func TestShutdownReversesStartupOrder(t *testing.T) {
+	recorder := &TypeStopRecorder{}
+	db := TypeStopRecordingService{id: "db", recorder: recorder}
+	c := gontainer.New()
+	c.RegisterService("db", &db)
+	c.RegisterService("api", &TypeStopRecordingConsumer{TypeStopRecordingService: TypeStopRecordingService{id: "api", recorder: recorder}})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+
+	if !reflect.DeepEqual(recorder.stopped, []string{"api", "db"}) {
+		t.Fatalf("expected api to stop before the db it depends on, got %v", recorder.stopped)
+	}
+}
+
+type TypeFixedClock struct {
+	now time.Time
+}
+
+func (c *TypeFixedClock) Now() time.Time { return c.now }
+
+type TypeClockService struct {
+	Clock gontainer.Clock `inject:""`
+}
+
+func TestWithClock(t *testing.T) {
+	clock := &TypeFixedClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := gontainer.New(gontainer.WithClock(clock))
+	c.RegisterService("svc", &TypeClockService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := c.GetServiceOrNil("svc").(*TypeClockService)
+	if !svc.Clock.Now().Equal(clock.now) {
+		t.Fatalf("expected %v, got %v", clock.now, svc.Clock.Now())
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	if !svc.Clock.Now().Equal(clock.now) {
+		t.Fatalf("expected %v after advancing the clock, got %v", clock.now, svc.Clock.Now())
+	}
+
+	scope := c.Scope()
+	scope.RegisterService("scoped", &TypeClockService{})
+	if err := scope.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if scope.GetServiceOrNil("scoped").(*TypeClockService).Clock != clock {
+		t.Fatal("expected the scope to inject the parent's clock")
+	}
+}
+
+type TypeNamedClockService struct {
+	Clock gontainer.Clock `inject:"utc"`
+}
+
+func TestNamedClock(t *testing.T) {
+	utc := &TypeFixedClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := gontainer.New()
+	c.RegisterService("utc", utc)
+	c.RegisterService("svc", &TypeNamedClockService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.GetServiceOrNil("svc").(*TypeNamedClockService).Clock != utc {
+		t.Fatal("expected the clock registered under the tag's name")
+	}
+}
+
+func TestDefaultClock(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("svc", &TypeClockService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	now := c.GetServiceOrNil("svc").(*TypeClockService).Clock.Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Fatalf("expected the real time, got %v", now)
+	}
+}
+
+type TypeProviderRepo struct {
+	Name string
+}
+
+type TypeProviderLogger interface {
+	Log(msg string)
+}
+
+type TypeProviderStdLogger struct {
+	lines []string
+}
+
+func (l *TypeProviderStdLogger) Log(msg string) { l.lines = append(l.lines, msg) }
+
+type TypeProvidedService struct {
+	repo *TypeProviderRepo
+	log  TypeProviderLogger
+}
+
+func NewTypeProvidedService(r *TypeProviderRepo, l TypeProviderLogger) *TypeProvidedService {
+	l.Log("using " + r.Name)
+	return &TypeProvidedService{repo: r, log: l}
+}
+
+type TypeProvidedConsumer struct {
+	Service *TypeProvidedService `inject:"service"`
+}
+
+type TypeProvidedWrapper struct {
+	service *TypeProvidedService
+}
+
+func TestRegisterProvider(t *testing.T) {
+	repo := &TypeProviderRepo{Name: "users"}
+	logger := &TypeProviderStdLogger{}
+	c := gontainer.New()
+	c.RegisterService("consumer", &TypeProvidedConsumer{})
+	c.RegisterProvider("wrapper", func(s *TypeProvidedService) *TypeProvidedWrapper {
+		return &TypeProvidedWrapper{service: s}
+	})
+	c.RegisterProvider("service", NewTypeProvidedService)
+	c.RegisterService("repo", repo)
+	c.RegisterService("logger", logger)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, ok := c.GetServiceOrNil("service").(*TypeProvidedService)
+	if !ok || svc == nil {
+		t.Fatalf("expected the provided service, got %v", c.GetServiceOrNil("service"))
+	}
+	if svc.repo != repo || svc.log != logger {
+		t.Fatal("expected the provider to get the registered dependencies")
+	}
+	if !slices.Equal(logger.lines, []string{"using users"}) {
+		t.Fatalf("expected the provider to be called once, got %v", logger.lines)
+	}
+	if c.GetServiceOrNil("consumer").(*TypeProvidedConsumer).Service != svc {
+		t.Fatal("expected the provided service to be injected")
+	}
+	if c.GetServiceOrNil("wrapper").(*TypeProvidedWrapper).service != svc {
+		t.Fatal("expected a provider to get the result of another")
+	}
+}
+
+func TestRegisterProviderErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		register func(c gontainer.Container)
+		msg      string
+	}{
+		{
+			name:     "missing",
+			register: func(c gontainer.Container) {},
+			msg:      "failed to call provider service: no value of type *gontainer_test.TypeProviderRepo for parameter 0",
+		},
+		{
+			name: "ambiguous",
+			register: func(c gontainer.Container) {
+				c.RegisterService("repo", &TypeProviderRepo{})
+				c.RegisterService("logger", &TypeProviderStdLogger{})
+				c.RegisterService("other-logger", &TypeProviderStdLogger{})
+			},
+			msg: "failed to call provider service: found 2 values of type gontainer_test.TypeProviderLogger " +
+				"for parameter 1: logger, other-logger",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gontainer.New()
+			c.RegisterProvider("service", NewTypeProvidedService)
+			tc.register(c)
+
+			err := c.Ready()
+			if err == nil {
+				t.Fatal("did not find expected error")
+			}
+			if err.Error() != tc.msg {
+				t.Fatalf("expected:\n%s\nactual:\n%s", tc.msg, err.Error())
+			}
+		})
+	}
+}
+
+func TestRegisterProviderRejectsNonProviders(t *testing.T) {
+	defer func() {
+		err, _ := recover().(error)
+		const msg = "failed to register provider service: func() gontainer_test.TypeProviderRepo is not a function returning a pointer"
+		if err == nil || err.Error() != msg {
+			t.Fatalf("expected:\n%s\nactual:\n%v", msg, err)
+		}
+	}()
+	gontainer.New().RegisterProvider("service", func() TypeProviderRepo { return TypeProviderRepo{} })
+}
+
+func TestRegisterProviderCycle(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterProvider("a", func(*TypeProvidedWrapper) *TypeProvidedService { return &TypeProvidedService{} })
+	c.RegisterProvider("b", func(*TypeProvidedService) *TypeProvidedWrapper { return &TypeProvidedWrapper{} })
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to call providers: a, b depend on each other"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestRegisterProviderCallsBackIntoContainer(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("repo", &TypeProviderRepo{Name: "users"})
+	var ids []string
+	c.RegisterProvider("wrapper", func(*TypeProviderRepo) *TypeProvidedWrapper {
+		ids = c.IDs()
+		return &TypeProvidedWrapper{}
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- c.Ready() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Ready not to deadlock on a provider using the container")
+	}
+	if !slices.Equal(ids, []string{"repo", "wrapper"}) {
+		t.Fatalf("expected the provider to see the services, got %v", ids)
+	}
+}
+
+func TestReloadProviderCallsBackIntoContainer(t *testing.T) {
+	c := gontainer.New()
+	calls := 0
+	c.RegisterProvider("wrapper", func() *TypeProvidedWrapper {
+		calls++
+		c.GetServiceOrNil("wrapper")
+		return &TypeProvidedWrapper{}
+	})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Reload("wrapper") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Reload not to deadlock on a provider using the container")
+	}
+	if calls != 2 {
+		t.Fatalf("expected the provider to be called again, got %d calls", calls)
+	}
+}
+
+type TypeReloadService struct {
+	id     string
+	events *[]string
+}
+
+func (s *TypeReloadService) Startup() error {
+	*s.events = append(*s.events, "start "+s.id)
+	return nil
+}
+
+func (s *TypeReloadService) Shutdown() error {
+	*s.events = append(*s.events, "stop "+s.id)
+	return nil
+}
+
+type TypeReloadConfig struct {
+	TypeReloadService
+	Version int
+}
+
+type TypeReloadConsumer struct {
+	TypeReloadService
+	Config *TypeReloadConfig `inject:"config"`
+}
+
+type TypeReloadEdge struct {
+	TypeReloadService
+	API *TypeReloadConsumer `inject:"api"`
+}
+
+func newReloadContainer(events *[]string) gontainer.Container {
+	version := 0
+	c := gontainer.New()
+	c.RegisterProvider("config", func() *TypeReloadConfig {
+		version++
+		return &TypeReloadConfig{TypeReloadService: TypeReloadService{id: "config", events: events}, Version: version}
+	})
+	c.RegisterService("api", &TypeReloadConsumer{TypeReloadService: TypeReloadService{id: "api", events: events}})
+	c.RegisterService("edge", &TypeReloadEdge{TypeReloadService: TypeReloadService{id: "edge", events: events}})
+	c.RegisterService("cache", &TypeReloadService{id: "cache", events: events})
+	return c
+}
+
+func TestReloadLeaf(t *testing.T) {
+	var events []string
+	c := newReloadContainer(&events)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	events = nil
+	if err := c.Reload("cache"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"stop cache", "start cache"}
+	if !slices.Equal(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+}
+
+func TestReloadDependents(t *testing.T) {
+	var events []string
+	c := newReloadContainer(&events)
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	old := c.GetServiceOrNil("config").(*TypeReloadConfig)
+
+	events = nil
+	if err := c.Reload("config"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"stop edge", "stop api", "stop config", "start config", "start api", "start edge"}
+	if !slices.Equal(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+
+	config := c.GetServiceOrNil("config").(*TypeReloadConfig)
+	if config == old || config.Version != 2 {
+		t.Fatalf("expected a fresh config from the provider, got version %d", config.Version)
+	}
+	if c.GetServiceOrNil("api").(*TypeReloadConsumer).Config != config {
+		t.Fatal("expected the dependent to be wired to the fresh config")
+	}
+}
+
+func TestReloadErrors(t *testing.T) {
+	var events []string
+	c := newReloadContainer(&events)
+
+	err := c.Reload("cache")
+	const notReady = "failed to reload services: container is not ready"
+	if err == nil || err.Error() != notReady {
+		t.Fatalf("expected:\n%s\nactual:\n%v", notReady, err)
+	}
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Reload("missing")
+	const notFound = "failed to reload service missing: service not found"
+	if err == nil || err.Error() != notFound {
+		t.Fatalf("expected:\n%s\nactual:\n%v", notFound, err)
+	}
+}
+
+type TypeStarterOnly struct {
+	started bool
+}
+
+func (s *TypeStarterOnly) Startup() error {
+	s.started = true
+	return nil
+}
+
+type TypeStopperOnly struct {
+	stopped bool
+}
+
+func (s *TypeStopperOnly) Shutdown() error {
+	s.stopped = true
+	return nil
+}
+
+func TestStarterAndStopperOnly(t *testing.T) {
+	starter := &TypeStarterOnly{}
+	stopper := &TypeStopperOnly{}
+	c := gontainer.New()
+	c.RegisterService("starter", starter)
+	c.RegisterService("stopper", stopper)
+
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if !starter.started {
+		t.Fatal("expected the starter to be started")
+	}
+	if stopper.stopped {
+		t.Fatal("expected the stopper not to be stopped yet")
+	}
+
+	c.Shutdown()
+	if !stopper.stopped {
+		t.Fatal("expected the stopper to be stopped")
+	}
+}
+
+type TypeWaitingWorker struct {
+	events chan string
+}
+
+func (w *TypeWaitingWorker) StartupContext(ctx context.Context) error {
+	c, ok := gontainer.FromContext(ctx)
+	if !ok {
+		return errors.New("no container in context")
+	}
+	go func() {
+		if err := c.WaitFor(context.Background(), "db"); err != nil {
+			w.events <- "worker: " + err.Error()
+			return
+		}
+		w.events <- "worker proceeding"
+	}()
+	return nil
+}
+
+type TypeSignalingService struct {
+	events chan string
+	err    error
+}
+
+func (s *TypeSignalingService) Startup() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events <- "db started"
+	return nil
+}
+
+func (s *TypeSignalingService) Shutdown() error { return nil }
+
+func TestWaitFor(t *testing.T) {
+	events := make(chan string, 2)
+	c := gontainer.New()
+	c.RegisterService("worker", &TypeWaitingWorker{events: events})
+	c.RegisterService("db", &TypeSignalingService{events: events})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"db started", "worker proceeding"}
+	for _, e := range expected {
+		select {
+		case actual := <-events:
+			if actual != e {
+				t.Fatalf("expected %q, got %q", e, actual)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", e)
+		}
+	}
+
+	if err := c.WaitFor(context.Background(), "db"); err != nil {
+		t.Fatalf("expected a started service not to block, got %v", err)
+	}
+}
+
+func TestWaitForFailedStartup(t *testing.T) {
+	events := make(chan string, 1)
+	c := gontainer.New()
+	c.RegisterService("worker", &TypeWaitingWorker{events: events})
+	c.RegisterServiceCritical("db", false, &TypeSignalingService{events: events, err: errors.New("unreachable")})
+	var degraded *gontainer.DegradedError
+	if err := c.Ready(); !errors.As(err, &degraded) {
+		t.Fatalf("expected a DegradedError, got %v", err)
+	}
+
+	select {
+	case actual := <-events:
+		const expected = "worker: failed to wait for service db: unreachable"
+		if actual != expected {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the worker")
+	}
+}
+
+func TestWaitForAbortedReady(t *testing.T) {
+	events := make(chan string, 1)
+	c := gontainer.New()
+	c.RegisterService("worker", &TypeWaitingWorker{events: events})
+	c.RegisterService("failing", &TypeFailingService{})
+	c.RegisterService("db", &TypeSignalingService{events: events})
+	if err := c.Ready(); err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	select {
+	case actual := <-events:
+		const expected = "worker: failed to wait for service db: failed to start service failing: boom"
+		if actual != expected {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the worker")
+	}
+}
+
+func TestWaitForContext(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("db", &TypeSignalingService{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.WaitFor(ctx, "db"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	err := c.WaitFor(context.Background(), "missing")
+	const msg = "failed to wait for service missing: service not found"
+	if err == nil || err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%v", msg, err)
+	}
+}
+
+type TypeCache interface {
+	Get(key string) string
+}
+
+type TypeMemoryCache struct{}
+
+func (c *TypeMemoryCache) Get(key string) string { return "memory:" + key }
+
+type TypeRedisCache struct{}
+
+func (c *TypeRedisCache) Get(key string) string { return "redis:" + key }
+
+type TypeCacheUser struct {
+	Cache TypeCache `inject:""`
+}
+
+func TestBindInterface(t *testing.T) {
+	redis := &TypeRedisCache{}
+	c := gontainer.New()
+	c.RegisterService("memory", &TypeMemoryCache{})
+	c.RegisterService("redis", redis)
+	c.RegisterService("user", &TypeCacheUser{})
+	c.BindInterface((*TypeCache)(nil), "redis")
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.GetServiceOrNil("user").(*TypeCacheUser).Cache != redis {
+		t.Fatal("expected the bound implementation to be injected")
+	}
+}
+
+func TestBindInterfaceUnknownService(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("memory", &TypeMemoryCache{})
+	c.RegisterService("user", &TypeCacheUser{})
+	c.BindInterface((*TypeCache)(nil), "redis")
+
+	err := c.Ready()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "failed to populate graph: did not find object named redis bound to gontainer_test.TypeCache " +
+		"required by field Cache in type *gontainer_test.TypeCacheUser"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestBindInterfaceRejectsNonInterfaces(t *testing.T) {
+	defer func() {
+		err, _ := recover().(error)
+		const msg = "failed to bind service redis: *gontainer_test.TypeRedisCache is not a pointer to an interface"
+		if err == nil || err.Error() != msg {
+			t.Fatalf("expected:\n%s\nactual:\n%v", msg, err)
+		}
+	}()
+	gontainer.New().BindInterface((*TypeRedisCache)(nil), "redis")
+}
+
+func transcriptSummary(events []gontainer.LifecycleEvent) []string {
+	summary := make([]string, 0, len(events))
+	for _, e := range events {
+		line := e.Phase + " " + e.ID
+		if e.Err != nil {
+			line += ": " + e.Err.Error()
+		}
+		summary = append(summary, line)
+	}
+	return summary
+}
+
+func TestTranscript(t *testing.T) {
+	var events []string
+	clock := &TypeFixedClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := gontainer.New(gontainer.WithClock(clock))
+	c.RegisterService("db", &TypeReloadService{id: "db", events: &events})
+	c.RegisterService("cache", &TypeReloadService{id: "cache", events: &events})
+	c.RegisterService("plain", &TypeDependency{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+
+	expected := []string{"startup db", "startup cache", "shutdown cache", "shutdown db"}
+	transcript := c.Transcript()
+	if actual := transcriptSummary(transcript); !slices.Equal(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for _, e := range transcript {
+		if e.StartedAt.Equal(clock.now) || e.Duration < 0 {
+			t.Fatalf("expected real times, got %v and %v", e.StartedAt, e.Duration)
+		}
+	}
+}
+
+func TestTranscriptRecordsFailures(t *testing.T) {
+	var events []string
+	c := gontainer.New()
+	c.RegisterService("db", &TypeReloadService{id: "db", events: &events})
+	c.RegisterService("cache", &TypeReloadService{id: "cache", events: &events})
+	c.RegisterService("api", &TypeFailingService{})
+	if err := c.Ready(); err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	expected := []string{"startup db", "startup cache", "startup api: boom", "shutdown cache", "shutdown db"}
+	if actual := transcriptSummary(c.Transcript()); !slices.Equal(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,96 @@
+// Package debughttp serves an introspection admin surface for a container
+// over HTTP. It lives apart from the gontainer package so that the core
+// doesn't depend on net/http.
+package debughttp
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/tommynurwantoro/gontainer"
+)
+
+// Handler returns a handler serving the container's introspection endpoints:
+//
+//   - /graph, the services and their dependencies as JSON, or as an HTML page
+//     when the request accepts text/html
+//   - /health, the result of each health check, with status 503 if any fails
+//   - /services, the service ids and whether they are started
+//
+// Mount it under a prefix with http.StripPrefix, for example:
+//
+//	mux.Handle("/debug/container/", http.StripPrefix("/debug/container", debughttp.Handler(c)))
+func Handler(c gontainer.Container) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graph", func(w http.ResponseWriter, r *http.Request) {
+		infos := c.Describe()
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := graphPage.Execute(w, infos); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, infos)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		results := make(map[string]string)
+		for id, err := range c.Health(r.Context()) {
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				results[id] = err.Error()
+				continue
+			}
+			results[id] = "ok"
+		}
+		writeJSON(w, status, results)
+	})
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		infos := c.Describe()
+		services := make([]service, 0, len(infos))
+		for _, info := range infos {
+			state := "registered"
+			if info.Started {
+				state = "started"
+			}
+			services = append(services, service{ID: info.ID, State: state})
+		}
+		writeJSON(w, http.StatusOK, services)
+	})
+	return mux
+}
+
+// service is an entry of the /services listing.
+type service struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+var graphPage = template.Must(template.New("graph").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Services</title></head>
+<body>
+<h1>Services</h1>
+<table>
+<tr><th>ID</th><th>Type</th><th>Started</th><th>Dependencies</th></tr>
+{{range .}}<tr id="{{.ID}}">
+<td>{{.ID}}</td>
+<td><code>{{.TypeName}}</code></td>
+<td>{{.Started}}</td>
+<td>{{range $i, $dep := .Dependencies}}{{if $i}}, {{end}}<a href="#{{$dep}}">{{$dep}}</a>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
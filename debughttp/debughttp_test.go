@@ -0,0 +1,114 @@
+package debughttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tommynurwantoro/gontainer"
+	"github.com/tommynurwantoro/gontainer/debughttp"
+)
+
+type TypeDependency struct {
+	N int
+}
+
+type TypeService struct {
+	Dep *TypeDependency `inject:""`
+}
+
+func (s *TypeService) Startup() error  { return nil }
+func (s *TypeService) Shutdown() error { return nil }
+
+type TypeHealthCheck struct {
+	err error
+}
+
+func (s *TypeHealthCheck) HealthCheck(ctx context.Context) error { return s.err }
+
+func newContainer(t *testing.T) gontainer.Container {
+	c := gontainer.New()
+	c.RegisterService("api", &TypeService{})
+	c.RegisterService("db", &TypeHealthCheck{})
+	c.RegisterService("cache", &TypeHealthCheck{err: errors.New("unreachable")})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func get(h http.Handler, path, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGraph(t *testing.T) {
+	w := get(debughttp.Handler(newContainer(t)), "/graph", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var infos []gontainer.ServiceInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 || infos[0].ID != "api" {
+		t.Fatalf("expected the three services, got %+v", infos)
+	}
+	if !reflect.DeepEqual(infos[0].Dependencies, []string{"*debughttp_test.TypeDependency"}) {
+		t.Fatalf("expected the api dependencies, got %v", infos[0].Dependencies)
+	}
+}
+
+func TestGraphHTML(t *testing.T) {
+	w := get(debughttp.Handler(newContainer(t)), "/graph", "text/html")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected an HTML page, got %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "<code>*debughttp_test.TypeService</code>") {
+		t.Fatalf("expected the service types in the page, got:\n%s", w.Body.String())
+	}
+}
+
+func TestHealth(t *testing.T) {
+	w := get(debughttp.Handler(newContainer(t)), "/health", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+
+	var results map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"db": "ok", "cache": "unreachable"}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestServices(t *testing.T) {
+	w := get(debughttp.Handler(newContainer(t)), "/services", "")
+
+	var services []map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &services); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]string{
+		{"id": "api", "state": "started"},
+		{"id": "db", "state": "registered"},
+		{"id": "cache", "state": "registered"},
+	}
+	if !reflect.DeepEqual(services, expected) {
+		t.Fatalf("expected %v, got %v", expected, services)
+	}
+}
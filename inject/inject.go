@@ -7,17 +7,37 @@ package inject
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// ErrMalformedTag is returned when a struct tag mentioning inject does not
+// follow the struct tag grammar.
+var ErrMalformedTag = errors.New("malformed inject tag")
+
 // Logger allows for simple logging as inject traverses and populates the
 // object graph.
 type Logger interface {
 	Debugf(format string, v ...interface{})
 }
 
+// LeveledLogger is an optional extension of Logger. When the graph's Logger
+// implements it, object creation and provisioning are logged at info level
+// while per-field assignments remain at debug level.
+type LeveledLogger interface {
+	Logger
+	Infof(format string, v ...interface{})
+}
+
 // Populate is a short-hand for populating a graph with the given incomplete
 // object values.
 func Populate(values ...interface{}) error {
@@ -36,11 +56,16 @@ type Object struct {
 	Name         string             // Optional
 	Complete     bool               // If true, the Value will be considered complete
 	Fields       map[string]*Object // Populated with the field names that were injected and their corresponding *Object.
+	DeclaredType reflect.Type       // Optional, the pointer type of a nil Value, see Replace.
+	Tags         map[string]string  // Optional, metadata such as an owner, ignored by the injector.
 	reflectType  reflect.Type
 	reflectValue reflect.Value
-	private      bool // If true, the Value will not be used and will only be populated
-	created      bool // If true, the Object was created by us
-	embedded     bool // If true, the Object is an embedded struct provided internally
+	key          string  // Identity of an unnamed object, assigned when it is provided
+	creator      *Object // The object whose field this created object was made for
+	creatorField string  // The field of creator this created object was made for
+	private      bool    // If true, the Value will not be used and will only be populated
+	created      bool    // If true, the Object was created by us
+	embedded     bool    // If true, the Object is an embedded struct provided internally
 }
 
 // String representation suitable for human consumption.
@@ -53,6 +78,42 @@ func (o *Object) String() string {
 	return buf.String()
 }
 
+// Key returns a stable identity for the object within its graph: its name if
+// it has one, and otherwise its type, suffixed with "#n" for the n-th unnamed
+// object of that type to be provided. Objects provided in the same order to
+// two graphs have the same keys.
+func (o *Object) Key() string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.key
+}
+
+// Type returns the type of the object's value, as recorded when it was
+// provided.
+func (o *Object) Type() reflect.Type {
+	return o.reflectType
+}
+
+// IsPrivate reports whether the object was created for a private inject and
+// is therefore never shared.
+func (o *Object) IsPrivate() bool {
+	return o.private
+}
+
+// IsCreated reports whether the object was created by the graph rather than
+// provided.
+func (o *Object) IsCreated() bool {
+	return o.created
+}
+
+// isPlaceholder reports whether the object is a nil pointer, such as one
+// provided with a DeclaredType. Placeholders are injected as nil and not
+// populated until they are replaced.
+func (o *Object) isPlaceholder() bool {
+	return o.reflectValue.Kind() == reflect.Ptr && o.reflectValue.IsNil()
+}
+
 func (o *Object) addDep(field string, dep *Object) {
 	if o.Fields == nil {
 		o.Fields = make(map[string]*Object)
@@ -62,20 +123,90 @@ func (o *Object) addDep(field string, dep *Object) {
 
 // The Graph of Objects.
 type Graph struct {
-	Logger      Logger // Optional, will trigger debug logging.
+	Logger      Logger                 // Optional, will trigger debug logging.
+	EnableStats bool                   // Optional, records per object populate durations.
+	Values      map[string]interface{} // Optional, fills fields tagged "value:key".
+	WarnOnSkip  bool                   // Optional, logs tagged fields skipped because they are set.
+	Skip        func(*Object) bool     // Optional, objects it returns true for are left incomplete.
+	// Optional, custom resolvers consulted in order before the built-in
+	// resolution. A resolver returning handled=true sets the field.
+	Resolvers []func(field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error)
+	// Optional, resolvers like Resolvers that are also given the object
+	// owning the field. They are consulted after Resolvers.
+	ObjectResolvers []func(o *Object, field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error)
+	// Optional, constructors keyed by pointer type. When the graph creates a
+	// dependency of a type listed here it calls the constructor instead of
+	// allocating a zero value.
+	Constructors map[reflect.Type]func() interface{}
+	// Optional, draws private created dependencies from a pool per type
+	// instead of allocating them. Return them with Release.
+	UsePool bool
+	// Optional, fills fields tagged `inject:""` from the object named after
+	// the field, when there is one of an assignable type, before resolving
+	// them by type.
+	NameByField bool
+	// Optional, limits on the number of objects in the graph and on the
+	// length of chains of created objects, guarding against runaway
+	// creation. Zero means unlimited.
+	MaxObjects int
+	MaxDepth   int
+	// Optional, populates the tagged fields of exported structs embedded by
+	// value as if they were tagged `inject:"inline"`.
+	AutoInline bool
+	// Optional, adapters consulted in order when no object is assignable to
+	// a field. An adapter matching from and to returns a function wrapping a
+	// value of type from into a value assignable to to.
+	Adapters []func(from reflect.Type, to reflect.Type) (func(interface{}) interface{}, bool)
+	// Optional, the names of the objects assigned to untagged fields of the
+	// given interface types, ahead of any other assignable object.
+	Bindings map[reflect.Type]string
+	// Optional, held by lazy provider functions while they resolve their
+	// dependency, which may happen on any goroutine once populated. Share it
+	// with whatever else reads or changes the graph after populating it.
+	// Defaults to a lock of the graph's own.
+	Locker      sync.Locker
+	lazy        sync.Mutex
 	unnamed     []*Object
 	unnamedType map[reflect.Type]bool
 	named       map[string]*Object
+	// Named objects in the order they were provided
+	namedOrder []*Object
 	// Performance optimizations: type index for O(1) lookups
 	typeIndex map[reflect.Type][]*Object // Maps types to objects that can be assigned to that type
 	// Cache for parsed tags to avoid repeated parsing
 	tagCache map[reflect.StructTag]*tag
+	// Per object populate durations, recorded when EnableStats is set
+	stats map[*Object]time.Duration
+	// Keyed private objects created during the current populate pass
+	shared map[sharedKey]*Object
+	// Number of unnamed objects provided per type, for their keys
+	unnamedCount map[reflect.Type]int
+	// Callback of the running PopulateVerbose
+	onDecision func(Decision)
+	// Objects left alone while populating what a lazy provider created
+	settled map[*Object]bool
+}
+
+// sharedKey identifies a keyed private object, as in `inject:"private:key"`.
+type sharedKey struct {
+	key string
+	typ reflect.Type
 }
 
 // Provide objects to the Graph. The Object documentation describes
 // the impact of various fields.
 func (g *Graph) Provide(objects ...*Object) error {
 	for _, o := range objects {
+		if o.Value == nil && o.DeclaredType != nil {
+			if o.DeclaredType.Kind() != reflect.Ptr {
+				return fmt.Errorf(
+					"declared type %s of nil object named %s is not a pointer",
+					o.DeclaredType,
+					o.Name,
+				)
+			}
+			o.Value = reflect.Zero(o.DeclaredType).Interface()
+		}
 		o.reflectType = reflect.TypeOf(o.Value)
 		o.reflectValue = reflect.ValueOf(o.Value)
 
@@ -108,6 +239,19 @@ func (g *Graph) Provide(objects ...*Object) error {
 					)
 				}
 				g.unnamedType[o.reflectType] = true
+
+				// Keep an already built type index in sync.
+				if g.typeIndex != nil {
+					g.typeIndex[o.reflectType] = append(g.typeIndex[o.reflectType], o)
+				}
+			}
+			if g.unnamedCount == nil {
+				g.unnamedCount = make(map[reflect.Type]int)
+			}
+			g.unnamedCount[o.reflectType]++
+			o.key = o.reflectType.String()
+			if n := g.unnamedCount[o.reflectType]; n > 1 {
+				o.key = fmt.Sprintf("%s#%d", o.key, n)
 			}
 			g.unnamed = append(g.unnamed, o)
 		} else {
@@ -119,76 +263,228 @@ func (g *Graph) Provide(objects ...*Object) error {
 				return fmt.Errorf("provided two instances named %s", o.Name)
 			}
 			g.named[o.Name] = o
+			g.namedOrder = append(g.namedOrder, o)
 		}
 
 		if g.Logger != nil {
 			if o.created {
-				g.Logger.Debugf("created %s", o)
+				g.infof("created %s", o)
 			} else if o.embedded {
-				g.Logger.Debugf("provided embedded %s", o)
+				g.infof("provided embedded %s", o)
 			} else {
-				g.Logger.Debugf("provided %s", o)
+				g.infof("provided %s", o)
 			}
 		}
 	}
 	return nil
 }
 
-// Populate the incomplete Objects.
+// Populate the incomplete Objects. Pointer, map, value and named fields of
+// every object are injected in a first pass, and interface and collection
+// fields in a second pass once all concrete objects exist. Objects provided
+// during either pass go through both passes as well.
 func (g *Graph) Populate() error {
-	for _, o := range g.named {
-		if o.Complete {
-			continue
+	if errs := g.populate(false); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Action is the kind of a wiring Decision.
+type Action string
+
+const (
+	ActionAssignedExisting  Action = "assigned-existing"  // A field was assigned an object of the graph
+	ActionCreated           Action = "created"            // A field was assigned an object created for it
+	ActionAssignedInterface Action = "assigned-interface" // An interface field was assigned an object of the graph
+	ActionSkipped           Action = "skipped"            // A field was left alone because it was already set
+	ActionError             Action = "error"              // The object could not be populated
+)
+
+// Decision is a wiring decision made while populating the graph, as reported
+// by PopulateVerbose.
+type Decision struct {
+	Object *Object // The object being populated
+	Field  string  // The field, with an index or key for collection members, empty for errors
+	Action Action
+	Target *Object // The object assigned to the field, nil when none was
+	Err    error   // The error of an ActionError
+}
+
+// PopulateVerbose populates the graph like Populate, calling onDecision with
+// each wiring decision as it is made.
+func (g *Graph) PopulateVerbose(onDecision func(Decision)) error {
+	g.onDecision = onDecision
+	defer func() { g.onDecision = nil }()
+	return g.Populate()
+}
+
+// decide reports a wiring decision to the PopulateVerbose callback, if any.
+func (g *Graph) decide(o *Object, field string, action Action, target *Object) {
+	if g.onDecision != nil {
+		g.onDecision(Decision{Object: o, Field: field, Action: action, Target: target})
+	}
+}
+
+// PopulateAll populates every incomplete object like Populate, but instead of
+// stopping at the first error it collects the errors of all objects that
+// could not be wired. Those objects are left incomplete.
+func (g *Graph) PopulateAll() []error {
+	return g.populate(true)
+}
+
+// populate runs both populate passes. Unless collect is set it returns as
+// soon as an object fails.
+func (g *Graph) populate(collect bool) []error {
+	g.shared = nil
+	if g.EnableStats {
+		g.stats = make(map[*Object]time.Duration)
+	}
+
+	var errs []error
+	failed := make(map[*Object]bool)
+	run := func(o *Object, populate func(*Object) error) bool {
+		if o.Complete || o.isPlaceholder() || failed[o] || g.settled[o] || (g.Skip != nil && g.Skip(o)) {
+			return true
+		}
+		if err := g.timed(o, populate); err != nil {
+			if g.onDecision != nil {
+				g.onDecision(Decision{Object: o, Action: ActionError, Err: err})
+			}
+			errs = append(errs, err)
+			failed[o] = true
+			return collect
 		}
+		return true
+	}
 
-		if err := g.populateExplicit(o); err != nil {
-			return err
+	// Objects may be provided while populating, for example by a resolver, so
+	// both passes are repeated until a round provides no new objects. Each
+	// object goes through each pass only once, and through the interface pass
+	// only after the explicit one.
+	explicit := make(map[*Object]bool)
+	interfaces := make(map[*Object]bool)
+	explicitPass := func(o *Object) bool {
+		if explicit[o] {
+			return true
+		}
+		explicit[o] = true
+		return run(o, g.populateExplicit)
+	}
+	interfacePass := func(o *Object) bool {
+		if interfaces[o] || !explicit[o] {
+			return true
 		}
+		interfaces[o] = true
+		return run(o, g.populateUnnamedInterface)
 	}
 
-	// We append and modify our slice as we go along, so we don't use a standard
-	// range loop, and do a single pass thru each object in our graph.
-	i := 0
 	for {
-		if i == len(g.unnamed) {
-			break
+		for _, name := range g.names() {
+			if !explicitPass(g.named[name]) {
+				return errs
+			}
 		}
 
-		o := g.unnamed[i]
-		i++
-
-		if o.Complete {
-			continue
+		// We append and modify our slice as we go along, so we don't use a
+		// standard range loop, and do a single pass thru each object in our
+		// graph.
+		for i := 0; i < len(g.unnamed); i++ {
+			if !explicitPass(g.unnamed[i]) {
+				return errs
+			}
 		}
 
-		if err := g.populateExplicit(o); err != nil {
-			return err
+		// A Second pass handles injecting Interface values to ensure we have
+		// created all concrete types first.
+		for i := 0; i < len(g.unnamed); i++ {
+			if !interfacePass(g.unnamed[i]) {
+				return errs
+			}
 		}
-	}
 
-	// A Second pass handles injecting Interface values to ensure we have created
-	// all concrete types first.
-	for _, o := range g.unnamed {
-		if o.Complete {
-			continue
+		for _, name := range g.names() {
+			if !interfacePass(g.named[name]) {
+				return errs
+			}
 		}
 
-		if err := g.populateUnnamedInterface(o); err != nil {
-			return err
+		if len(interfaces) == len(g.unnamed)+len(g.named) {
+			return errs
 		}
 	}
+}
 
-	for _, o := range g.named {
-		if o.Complete {
+// names returns a snapshot of the names of the named objects, sorted so that
+// populating is deterministic.
+func (g *Graph) names() []string {
+	names := make([]string, 0, len(g.named))
+	for name := range g.named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// infof logs at info level if the logger supports it, falling back to debug.
+func (g *Graph) infof(format string, v ...interface{}) {
+	if l, ok := g.Logger.(LeveledLogger); ok {
+		l.Infof(format, v...)
+		return
+	}
+	g.Logger.Debugf(format, v...)
+}
+
+// timed runs populate for the object, accumulating the time spent when stats
+// are enabled.
+func (g *Graph) timed(o *Object, populate func(*Object) error) error {
+	if !g.EnableStats {
+		return populate(o)
+	}
+	start := time.Now()
+	err := populate(o)
+	g.stats[o] += time.Since(start)
+	return err
+}
+
+// PopulateStats returns how long the last Populate spent wiring each object.
+// It is only recorded when EnableStats is set.
+func (g *Graph) PopulateStats() map[*Object]time.Duration {
+	stats := make(map[*Object]time.Duration, len(g.stats))
+	for o, d := range g.stats {
+		stats[o] = d
+	}
+	return stats
+}
+
+// GraphStats counts the objects known to a Graph. The categories overlap:
+// created and private objects are also counted as unnamed.
+type GraphStats struct {
+	NamedObjects   int // Objects provided with a name
+	UnnamedObjects int // Objects without a name, provided or created
+	CreatedObjects int // Objects created by the graph to satisfy a dependency
+	PrivateObjects int // Objects created for a single private field
+}
+
+// Stats returns counts of the objects in the graph. A surprising number of
+// created or private objects usually points at misconfigured wiring.
+// Objects provided for inline structs are not counted.
+func (g *Graph) Stats() GraphStats {
+	var stats GraphStats
+	for _, o := range g.Objects() {
+		if o.Name != "" {
+			stats.NamedObjects++
 			continue
 		}
-
-		if err := g.populateUnnamedInterface(o); err != nil {
-			return err
+		stats.UnnamedObjects++
+		if o.created {
+			stats.CreatedObjects++
+		}
+		if o.private {
+			stats.PrivateObjects++
 		}
 	}
-
-	return nil
+	return stats
 }
 
 func (g *Graph) populateExplicit(o *Object) error {
@@ -206,7 +502,7 @@ StructLoop:
 		tag, err := g.parseTagCached(fieldTag)
 		if err != nil {
 			// Check if it's a malformed tag error and format accordingly
-			if strings.Contains(err.Error(), "malformed inject tag") {
+			if errors.Is(err, ErrMalformedTag) {
 				return fmt.Errorf(
 					"unexpected tag format `%s` for field %s in type %s",
 					string(fieldTag),
@@ -223,9 +519,14 @@ StructLoop:
 			)
 		}
 
-		// Skip fields without a tag.
+		// Skip fields without a tag, except that embedded structs are
+		// inlined under AutoInline.
 		if tag == nil {
-			continue
+			if !g.AutoInline || !o.reflectType.Elem().Field(i).Anonymous ||
+				fieldType.Kind() != reflect.Struct || !field.CanSet() {
+				continue
+			}
+			tag = injectInline
 		}
 
 		// Cannot be used with unexported fields.
@@ -246,30 +547,182 @@ StructLoop:
 			)
 		}
 
-		// Don't overwrite existing values.
-		if !isNilOrZero(field, fieldType) {
+		// Don't overwrite existing values, unless forced.
+		if !tag.Force && !isNilOrZero(field, fieldType) {
+			if g.WarnOnSkip && g.Logger != nil {
+				g.infof(
+					"skipping inject on field %s in %s because it is already set",
+					fieldName,
+					o,
+				)
+			}
+			g.decide(o, fieldName, ActionSkipped, nil)
 			continue
 		}
 
+		// Custom resolvers get the first chance to handle the field.
+		if handled, err := g.resolveCustom(o, i, field); err != nil {
+			return err
+		} else if handled {
+			continue StructLoop
+		}
+
+		// Values are looked up by key rather than resolved from the graph.
+		if tag.ValueKey != "" {
+			if err := g.populateValue(o, field, fieldName, tag.ValueKey); err != nil {
+				return err
+			}
+			continue StructLoop
+		}
+
+		// The containing object's own name, empty for unnamed objects.
+		if tag.Self {
+			if fieldType.Kind() != reflect.String {
+				return fmt.Errorf(
+					"self:name requested on non string field %s in type %s",
+					o.reflectType.Elem().Field(i).Name,
+					o.reflectType,
+				)
+			}
+			field.SetString(o.Name)
+			continue StructLoop
+		}
+
+		// Provider functions get their dependency when first called, or
+		// during populate when eager.
+		if isProvider(fieldType) {
+			if err := g.populateProvider(o, field, fieldName, tag); err != nil {
+				return err
+			}
+			continue StructLoop
+		}
+		if tag.Eager || tag.Lazy {
+			return fmt.Errorf(
+				"eager or lazy requested on non provider field %s in type %s",
+				fieldName,
+				o.reflectType,
+			)
+		}
+
+		// Pointers to pointers are never assigned, even when an object of the
+		// pointed to type exists, so point at the fix.
+		if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Ptr {
+			return fmt.Errorf(
+				"inject on pointer to pointer field %s in type %s is not supported, use %s instead",
+				fieldName,
+				o.reflectType,
+				fieldType.Elem(),
+			)
+		}
+
+		// Only private maps of struct pointers by string keys can be filled
+		// with created objects, and only for the keys listed.
+		if tag.Populate || len(tag.Keys) > 0 {
+			if fieldType.Kind() != reflect.Map || fieldType.Key().Kind() != reflect.String ||
+				!isStructPtr(fieldType.Elem()) || !tag.Private {
+				return fmt.Errorf(
+					"populate requested on field %s in type %s which is not a private map of struct pointers by string keys",
+					fieldName,
+					o.reflectType,
+				)
+			}
+			if !tag.Populate || len(tag.Keys) == 0 {
+				return fmt.Errorf(
+					"populate and keys must be given together on map field %s in type %s",
+					fieldName,
+					o.reflectType,
+				)
+			}
+		}
+
+		// Only objects of struct pointer fields can be left unpopulated, and
+		// only those created for the field, as marking a shared object
+		// complete would depend on the order objects are populated in.
+		if tag.Complete && !isStructPtr(fieldType) {
+			return fmt.Errorf(
+				"complete requested on non struct pointer field %s in type %s",
+				fieldName,
+				o.reflectType,
+			)
+		}
+		if tag.Complete && tag.Name != "" {
+			return fmt.Errorf(
+				"complete requested on field %s in type %s naming object %s: only objects created for the field can be complete",
+				fieldName,
+				o.reflectType,
+				tag.Name,
+			)
+		}
+
+		// Untagged names fall back to the object named after the field.
+		if g.NameByField && tag.Name == "" && !tag.Private && !tag.Inline && !tag.Complete {
+			existing := g.named[fieldName]
+			if existing != nil && existing != o && existing.reflectType.AssignableTo(fieldType) {
+				field.Set(reflect.ValueOf(existing.Value))
+				if g.Logger != nil {
+					g.Logger.Debugf(
+						"assigned %s to field %s in %s by field name",
+						existing,
+						fieldName,
+						o,
+					)
+				}
+				o.addDep(fieldName, existing)
+				g.decide(o, fieldName, ActionAssignedExisting, existing)
+				continue StructLoop
+			}
+		}
+
+		// Slices tagged with a list of names are filled with those named
+		// objects in order, unless a single named slice value was provided.
+		if tag.Name != "" && fieldType.Kind() == reflect.Slice {
+			existing := g.named[tag.Name]
+			if len(tag.Names) > 1 || existing == nil || !existing.reflectType.AssignableTo(fieldType) {
+				if err := g.populateNamedSlice(o, field, fieldName, tag.Names); err != nil {
+					return err
+				}
+				continue StructLoop
+			}
+		}
+
 		// Named injects must have been explicitly provided.
 		if tag.Name != "" {
 			existing := g.named[tag.Name]
+			if existing == nil && fieldType.Kind() == reflect.Interface && g.isTypeReference(o, tag.Name) {
+				// Selected by type name in the second pass.
+				continue StructLoop
+			}
+			if existing == nil && tag.Optional {
+				if tag.Default && isStructPtr(fieldType) {
+					if err := g.populateDefault(o, field, fieldName); err != nil {
+						return err
+					}
+				}
+				continue StructLoop
+			}
 			if existing == nil {
 				return fmt.Errorf(
-					"did not find object named %s required by field %s in type %s",
+					"did not find object named %s required by field %s in type %s%s",
 					tag.Name,
 					o.reflectType.Elem().Field(i).Name,
 					o.reflectType,
+					g.suggestName(tag.Name),
 				)
 			}
 
 			if !existing.reflectType.AssignableTo(fieldType) {
+				if adapt := g.adapter(existing.reflectType, fieldType); adapt != nil {
+					if err := g.populateAdapted(o, field, fieldName, existing, adapt); err != nil {
+						return err
+					}
+					continue StructLoop
+				}
 				return fmt.Errorf(
 					"object named %s of type %s is not assignable to field %s (%s) in type %s",
 					tag.Name,
-					fieldType,
-					o.reflectType.Elem().Field(i).Name,
 					existing.reflectType,
+					o.reflectType.Elem().Field(i).Name,
+					fieldType,
 					o.reflectType,
 				)
 			}
@@ -284,6 +737,7 @@ StructLoop:
 				)
 			}
 			o.addDep(fieldName, existing)
+			g.decide(o, fieldName, ActionAssignedExisting, existing)
 			continue StructLoop
 		}
 
@@ -317,16 +771,60 @@ StructLoop:
 			continue
 		}
 
-		// Interface injection is handled in a second pass.
-		if fieldType.Kind() == reflect.Interface {
+		// Channels are created and required to be private.
+		if fieldType.Kind() == reflect.Chan {
+			if !tag.Private {
+				return fmt.Errorf(
+					"inject on channel field %s in type %s must be private",
+					o.reflectType.Elem().Field(i).Name,
+					o.reflectType,
+				)
+			}
+			if fieldType.ChanDir() != reflect.BothDir {
+				return fmt.Errorf(
+					"inject on channel field %s in type %s requires a bidirectional channel, not %s",
+					o.reflectType.Elem().Field(i).Name,
+					o.reflectType,
+					fieldType,
+				)
+			}
+
+			field.Set(reflect.MakeChan(fieldType, tag.Buffer))
+			if g.Logger != nil {
+				g.Logger.Debugf(
+					"made channel with buffer %d for field %s in %s",
+					tag.Buffer,
+					o.reflectType.Elem().Field(i).Name,
+					o,
+				)
+			}
+			continue
+		}
+
+		// A buffer size only makes sense for channels.
+		if tag.HasBuffer {
+			return fmt.Errorf(
+				"buffer size given for non channel field %s (%s) in type %s",
+				o.reflectType.Elem().Field(i).Name,
+				fieldType,
+				o.reflectType,
+			)
+		}
+
+		// Interface injection is handled in a second pass, and so are
+		// collections so that all concrete types exist first.
+		if fieldType.Kind() == reflect.Interface || isCollection(fieldType, tag) {
 			continue
 		}
 
-		// Maps are created and required to be private.
+		// Maps are created and required to be private, unless they are
+		// collections of named objects handled in the second pass.
 		if fieldType.Kind() == reflect.Map {
 			if !tag.Private {
 				return fmt.Errorf(
-					"inject on map field %s in type %s must be named or private",
+					"inject on map field %s in type %s must be named or private, "+
+						"or have string keys and interface or struct pointer "+
+						"values to collect named objects",
 					o.reflectType.Elem().Field(i).Name,
 					o.reflectType,
 				)
@@ -340,72 +838,131 @@ StructLoop:
 					o,
 				)
 			}
+			if tag.Populate {
+				if err := g.populateMapEntries(o, field, fieldName, tag.Keys); err != nil {
+					return err
+				}
+			}
 			continue
 		}
 
-		// Can only inject Pointers from here on.
+		// Pointers to interfaces are almost always a mistake, so point at the
+		// fix rather than reporting a generic unsupported field.
+		if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Interface {
+			return fmt.Errorf(
+				"inject on pointer to interface field %s in type %s is not supported, use %s instead",
+				o.reflectType.Elem().Field(i).Name,
+				o.reflectType,
+				fieldType.Elem(),
+			)
+		}
+
+		// Can only inject Pointers from here on. Other fields most likely
+		// want a named or value tag, or no tag at all.
 		if !isStructPtr(fieldType) {
 			return fmt.Errorf(
-				"found inject tag on unsupported field %s in type %s",
+				"found inject tag on unsupported field %s in type %s: inject only supports "+
+					"pointer-to-struct, interface, map, or named value fields; got %s",
 				o.reflectType.Elem().Field(i).Name,
 				o.reflectType,
+				fieldType,
 			)
 		}
 
 		// Unless it's a private inject, we'll look for an existing instance of the
 		// same type using optimized type index.
 		if !tag.Private {
-			// Build type index if not already built
-			if g.typeIndex == nil {
-				g.buildTypeIndex()
+			existing, other := g.findAssignable(fieldType)
+			if other != nil {
+				return fmt.Errorf(
+					"found two assignable values for field %s in type %s. one type "+
+						"%s with value %v and another type %s with value %v",
+					o.reflectType.Elem().Field(i).Name,
+					o.reflectType,
+					existing.reflectType,
+					existing.Value,
+					other.reflectType,
+					other.Value,
+				)
 			}
-
-			// Try direct type match first (fastest path)
-			if candidates := g.typeIndex[fieldType]; len(candidates) > 0 {
-				for _, existing := range candidates {
-					if existing.private {
-						continue
-					}
-					field.Set(reflect.ValueOf(existing.Value))
-					if g.Logger != nil {
-						g.Logger.Debugf(
-							"assigned existing %s to field %s in %s",
-							existing,
-							o.reflectType.Elem().Field(i).Name,
-							o,
-						)
-					}
-					o.addDep(fieldName, existing)
-					continue StructLoop
+			if existing != nil && tag.Complete && !existing.created {
+				return fmt.Errorf(
+					"complete requested on field %s in type %s assigned the provided %s: only objects created for the field can be complete",
+					fieldName,
+					o.reflectType,
+					existing,
+				)
+			}
+			if existing != nil && !tag.Complete {
+				field.Set(reflect.ValueOf(existing.Value))
+				if g.Logger != nil {
+					g.Logger.Debugf(
+						"assigned existing %s to field %s in %s",
+						existing,
+						o.reflectType.Elem().Field(i).Name,
+						o,
+					)
 				}
+				o.addDep(fieldName, existing)
+				g.decide(o, fieldName, ActionAssignedExisting, existing)
+				continue StructLoop
 			}
 
-			// Fallback to checking all objects if direct match failed (for interface types)
-			for _, existing := range g.unnamed {
-				if existing.private {
-					continue
+			// An adapted object is preferred over creating a new one.
+			if existing, adapt := g.findAdaptable(o, fieldType); existing != nil && !tag.Complete {
+				if err := g.populateAdapted(o, field, fieldName, existing, adapt); err != nil {
+					return err
 				}
-				if existing.reflectType.AssignableTo(fieldType) {
-					field.Set(reflect.ValueOf(existing.Value))
-					if g.Logger != nil {
-						g.Logger.Debugf(
-							"assigned existing %s to field %s in %s",
-							existing,
-							o.reflectType.Elem().Field(i).Name,
-							o,
-						)
+				continue StructLoop
+			}
+
+			// Optional injects are not created on demand. Only with a default
+			// do they get a zero value of their own.
+			if tag.Optional {
+				if tag.Default {
+					if err := g.populateDefault(o, field, fieldName); err != nil {
+						return err
 					}
-					o.addDep(fieldName, existing)
-					continue StructLoop
 				}
+				continue StructLoop
+			}
+		}
+
+		// Keyed private injects share one instance per key and type within a
+		// populate pass.
+		var shared sharedKey
+		if tag.SharedKey != "" {
+			shared = sharedKey{key: tag.SharedKey, typ: fieldType}
+			if existing := g.shared[shared]; existing != nil {
+				field.Set(reflect.ValueOf(existing.Value))
+				if g.Logger != nil {
+					g.Logger.Debugf(
+						"assigned shared private %s to field %s in %s",
+						existing,
+						o.reflectType.Elem().Field(i).Name,
+						o,
+					)
+				}
+				o.addDep(fieldName, existing)
+				g.decide(o, fieldName, ActionAssignedExisting, existing)
+				continue StructLoop
 			}
 		}
 
-		newValue := reflect.New(fieldType.Elem())
+		if err := g.checkLimits(o, fieldName); err != nil {
+			return err
+		}
+		newValue, err := g.construct(fieldType, tag.Private)
+		if err != nil {
+			return fmt.Errorf("%w for field %s in type %s", err, fieldName, o.reflectType)
+		}
 		newObject := &Object{
-			Value:   newValue.Interface(),
-			private: tag.Private,
-			created: true,
+			Value:        newValue.Interface(),
+			Complete:     tag.Complete,
+			private:      tag.Private || tag.Complete,
+			created:      true,
+			creator:      o,
+			creatorField: fieldName,
 		}
 
 		// Add the newly ceated object to the known set of objects.
@@ -414,6 +971,13 @@ StructLoop:
 			return err
 		}
 
+		if tag.SharedKey != "" {
+			if g.shared == nil {
+				g.shared = make(map[sharedKey]*Object)
+			}
+			g.shared[shared] = newObject
+		}
+
 		// Finally assign the newly created object to our field.
 		field.Set(newValue)
 		if g.Logger != nil {
@@ -425,116 +989,1328 @@ StructLoop:
 			)
 		}
 		o.addDep(fieldName, newObject)
+		g.decide(o, fieldName, ActionCreated, newObject)
 	}
 	return nil
 }
 
-func (g *Graph) populateUnnamedInterface(o *Object) error {
-	// Ignore named value types.
-	if o.Name != "" && !isStructPtr(o.reflectType) {
+// populateDefault assigns a newly allocated zero value to the struct pointer
+// field of o, for optional injects with a default that have no provider. The
+// value is private to the field.
+func (g *Graph) populateDefault(o *Object, field reflect.Value, fieldName string) error {
+	if err := g.checkLimits(o, fieldName); err != nil {
+		return err
+	}
+	newValue, err := g.construct(field.Type(), true)
+	if err != nil {
+		return fmt.Errorf("%w for field %s in type %s", err, fieldName, o.reflectType)
+	}
+	newObject := &Object{
+		Value:        newValue.Interface(),
+		private:      true,
+		created:      true,
+		creator:      o,
+		creatorField: fieldName,
+	}
+	if err := g.Provide(newObject); err != nil {
+		return err
+	}
+
+	field.Set(newValue)
+	if g.Logger != nil {
+		g.Logger.Debugf(
+			"assigned default %s to field %s in %s",
+			newObject,
+			fieldName,
+			o,
+		)
+	}
+	o.addDep(fieldName, newObject)
+	g.decide(o, fieldName, ActionCreated, newObject)
+	return nil
+}
+
+// populateMapEntries fills the private map field of o with a new private
+// object for each of keys. The objects are provided to the graph so that they
+// are populated like any other.
+func (g *Graph) populateMapEntries(o *Object, field reflect.Value, fieldName string, keys []string) error {
+	elemType := field.Type().Elem()
+	for _, key := range keys {
+		entry := fmt.Sprintf("%s[%s]", fieldName, key)
+		if err := g.checkLimits(o, entry); err != nil {
+			return err
+		}
+		newValue, err := g.construct(elemType, true)
+		if err != nil {
+			return fmt.Errorf("%w for field %s in type %s", err, entry, o.reflectType)
+		}
+		newObject := &Object{
+			Value:        newValue.Interface(),
+			private:      true,
+			created:      true,
+			creator:      o,
+			creatorField: entry,
+		}
+		if err := g.Provide(newObject); err != nil {
+			return err
+		}
+
+		field.SetMapIndex(reflect.ValueOf(key).Convert(field.Type().Key()), newValue)
+		if g.Logger != nil {
+			g.Logger.Debugf(
+				"assigned newly created %s to field %s in %s",
+				newObject,
+				entry,
+				o,
+			)
+		}
+		o.addDep(entry, newObject)
+		g.decide(o, entry, ActionCreated, newObject)
+	}
+	return nil
+}
+
+// isProvider reports whether t is a provider function type, func() *T for a
+// struct type T.
+func isProvider(t reflect.Type) bool {
+	return t.Kind() == reflect.Func && t.NumIn() == 0 && t.NumOut() == 1 && isStructPtr(t.Out(0))
+}
+
+// populateProvider sets the provider function field of o. A lazy provider,
+// the default, resolves its dependency the first time it is called,
+// populating the graph again if it had to create it, and panics if that
+// fails. An eager provider resolves it now.
+func (g *Graph) populateProvider(o *Object, field reflect.Value, fieldName string, tag *tag) error {
+	provider := func(dep *Object) reflect.Value {
+		return reflect.MakeFunc(field.Type(), func([]reflect.Value) []reflect.Value {
+			return []reflect.Value{reflect.ValueOf(dep.Value)}
+		})
+	}
+
+	if tag.Eager {
+		dep, _, err := g.resolveProvided(o, fieldName, field.Type().Out(0), tag)
+		if err != nil {
+			return err
+		}
+		field.Set(provider(dep))
+		o.addDep(fieldName, dep)
+		g.decide(o, fieldName, ActionAssignedExisting, dep)
 		return nil
 	}
 
-	for i := 0; i < o.reflectValue.Elem().NumField(); i++ {
-		field := o.reflectValue.Elem().Field(i)
-		fieldType := field.Type()
-		fieldTag := o.reflectType.Elem().Field(i).Tag
-		fieldName := o.reflectType.Elem().Field(i).Name
-		tag, err := g.parseTagCached(fieldTag)
-		if err != nil {
-			// Check if it's a malformed tag error and format accordingly
-			if strings.Contains(err.Error(), "malformed inject tag") {
-				return fmt.Errorf(
-					"unexpected tag format `%s` for field %s in type %s",
-					string(fieldTag),
-					o.reflectType.Elem().Field(i).Name,
-					o.reflectType,
-				)
-			}
+	var once sync.Once
+	var dep *Object
+	field.Set(reflect.MakeFunc(field.Type(), func([]reflect.Value) []reflect.Value {
+		once.Do(func() {
+			locker := g.Locker
+			if locker == nil {
+				locker = &g.lazy
+			}
+			locker.Lock()
+			defer locker.Unlock()
+
+			resolved, err := g.resolveLazy(o, fieldName, field.Type().Out(0), tag)
+			if err != nil {
+				panic(err)
+			}
+			o.addDep(fieldName, resolved)
+			dep = resolved
+		})
+		return []reflect.Value{reflect.ValueOf(dep.Value)}
+	}))
+	return nil
+}
+
+// resolveLazy resolves the dependency of a lazy provider function field like
+// resolveProvided, populating only the objects it creates so that the rest
+// of the graph is left as it is.
+func (g *Graph) resolveLazy(o *Object, fieldName string, t reflect.Type, tag *tag) (*Object, error) {
+	settled := make(map[*Object]bool, len(g.unnamed)+len(g.named))
+	for _, existing := range g.unnamed {
+		settled[existing] = true
+	}
+	for _, existing := range g.named {
+		settled[existing] = true
+	}
+
+	dep, created, err := g.resolveProvided(o, fieldName, t, tag)
+	if err != nil || !created {
+		return dep, err
+	}
+	g.settled = settled
+	defer func() { g.settled = nil }()
+	if err := g.Populate(); err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+// resolveProvided returns the object for a provider function field of o
+// returning t: the named object for a named tag, and otherwise the object
+// assignable to t, created and provided if there is none or the tag is
+// private.
+func (g *Graph) resolveProvided(o *Object, fieldName string, t reflect.Type, tag *tag) (*Object, bool, error) {
+	if tag.Name != "" {
+		existing := g.named[tag.Name]
+		if existing == nil {
+			return nil, false, fmt.Errorf(
+				"did not find object named %s required by field %s in type %s%s",
+				tag.Name,
+				fieldName,
+				o.reflectType,
+				g.suggestName(tag.Name),
+			)
+		}
+		if !existing.reflectType.AssignableTo(t) {
+			return nil, false, fmt.Errorf(
+				"object named %s of type %s is not assignable to field %s (%s) in type %s",
+				tag.Name,
+				existing.reflectType,
+				fieldName,
+				t,
+				o.reflectType,
+			)
+		}
+		return existing, false, nil
+	}
+
+	if !tag.Private {
+		existing, other := g.findAssignable(t)
+		if other != nil {
+			return nil, false, fmt.Errorf(
+				"found two assignable values for field %s in type %s. one type "+
+					"%s with value %v and another type %s with value %v",
+				fieldName,
+				o.reflectType,
+				existing.reflectType,
+				existing.Value,
+				other.reflectType,
+				other.Value,
+			)
+		}
+		if existing != nil {
+			return existing, false, nil
+		}
+	}
+
+	if err := g.checkLimits(o, fieldName); err != nil {
+		return nil, false, err
+	}
+	newValue, err := g.construct(t, tag.Private)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w for field %s in type %s", err, fieldName, o.reflectType)
+	}
+	newObject := &Object{
+		Value:        newValue.Interface(),
+		private:      tag.Private,
+		created:      true,
+		creator:      o,
+		creatorField: fieldName,
+	}
+	if err := g.Provide(newObject); err != nil {
+		return nil, false, err
+	}
+	return newObject, true, nil
+}
+
+// checkLimits returns an error if creating an object for the field of o would
+// exceed MaxObjects or MaxDepth, with the chain of fields leading to it.
+func (g *Graph) checkLimits(o *Object, fieldName string) error {
+	if g.MaxObjects > 0 && len(g.unnamed)+len(g.named) >= g.MaxObjects {
+		return fmt.Errorf(
+			"creating an object for %s would exceed the maximum of %d objects",
+			creationPath(o, fieldName),
+			g.MaxObjects,
+		)
+	}
+	if g.MaxDepth > 0 {
+		depth := 1
+		for c := o; c.creator != nil; c = c.creator {
+			depth++
+		}
+		if depth > g.MaxDepth {
+			return fmt.Errorf(
+				"creating an object for %s would exceed the maximum depth of %d",
+				creationPath(o, fieldName),
+				g.MaxDepth,
+			)
+		}
+	}
+	return nil
+}
+
+// creationPath describes the chain of fields through which the graph created
+// o, followed by fieldName, as in "*T.A -> *U.B".
+func creationPath(o *Object, fieldName string) string {
+	path := []string{fmt.Sprintf("%s.%s", o.reflectType, fieldName)}
+	for c := o; c.creator != nil; c = c.creator {
+		path = append(path, fmt.Sprintf("%s.%s", c.creator.reflectType, c.creatorField))
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return strings.Join(path, " -> ")
+}
+
+// construct returns a new instance of the struct pointer type t, built by its
+// registered constructor if there is one and allocated as a zero value
+// otherwise. Private zero values come from the type's pool when UsePool is
+// set.
+func (g *Graph) construct(t reflect.Type, private bool) (reflect.Value, error) {
+	constructor := g.Constructors[t]
+	if constructor == nil {
+		if g.UsePool && private {
+			return reflect.ValueOf(pool(t).Get()), nil
+		}
+		return reflect.New(t.Elem()), nil
+	}
+
+	built := constructor()
+	value := reflect.ValueOf(built)
+	if !value.IsValid() || value.Type() != t || value.IsNil() {
+		return reflect.Value{}, fmt.Errorf(
+			"constructor for %s returned %#v instead of a non nil %s",
+			t,
+			built,
+			t,
+		)
+	}
+	return value, nil
+}
+
+// Replace gives an object a new value of the same type, such as a
+// placeholder provided with a nil Value and a DeclaredType its real value.
+// The fields of incomplete objects that were assigned the object are reset,
+// so the next Populate injects the new value into them. The object's own
+// fields are populated by the next Populate unless it is complete.
+func (g *Graph) Replace(o *Object, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if reflect.TypeOf(value) != o.reflectType || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return fmt.Errorf("cannot replace %s with %#v", o, value)
+	}
+	o.Value = value
+	o.reflectValue = v
+	o.Fields = nil
+
+	for _, dependent := range g.Objects() {
+		if !dependent.Complete {
+			dependent.unassign(o)
+		}
+	}
+	return nil
+}
+
+// unassign resets the fields of o that were assigned dep. A collection field
+// holding dep is reset as a whole, to be collected again.
+func (o *Object) unassign(dep *Object) {
+	for key, assigned := range o.Fields {
+		if assigned != dep {
+			continue
+		}
+		name := key
+		if i := strings.IndexByte(key, '['); i >= 0 {
+			name = key[:i]
+		}
+		if field := o.reflectValue.Elem().FieldByName(name); field.CanSet() {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		for other := range o.Fields {
+			if other == name || strings.HasPrefix(other, name+"[") {
+				delete(o.Fields, other)
+			}
+		}
+	}
+}
+
+// pools holds a *sync.Pool of released private objects per pointer type. It
+// is shared by all graphs so short lived graphs, such as one per request, can
+// reuse each other's objects.
+var pools sync.Map
+
+// pool returns the pool for the struct pointer type t.
+func pool(t reflect.Type) *sync.Pool {
+	if p, ok := pools.Load(t); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := pools.LoadOrStore(t, &sync.Pool{New: func() interface{} {
+		return reflect.New(t.Elem()).Interface()
+	}})
+	return p.(*sync.Pool)
+}
+
+// Release removes a private object created by the graph and, when UsePool is
+// set, resets its value to zero and returns it to the pool for its type. The
+// object and its value must not be used after it is released. Objects it
+// depends on are not released.
+func (g *Graph) Release(o *Object) error {
+	if !o.created || !o.private {
+		return fmt.Errorf("cannot release %s because it was not created as a private object", o)
+	}
+
+	found := false
+	for i, existing := range g.unnamed {
+		if existing == o {
+			g.unnamed = append(g.unnamed[:i], g.unnamed[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("cannot release %s because it is not in the graph", o)
+	}
+	for key, shared := range g.shared {
+		if shared == o {
+			delete(g.shared, key)
+		}
+	}
+	delete(g.stats, o)
+
+	if g.UsePool {
+		o.reflectValue.Elem().Set(reflect.Zero(o.reflectType.Elem()))
+		pool(o.reflectType).Put(o.Value)
+	}
+	return nil
+}
+
+// resolveCustom consults the graph's Resolvers and then its ObjectResolvers
+// for the i-th field of o, setting the field from the first resolver that handles it.
+func (g *Graph) resolveCustom(o *Object, i int, field reflect.Value) (bool, error) {
+	structField := o.reflectType.Elem().Field(i)
+	fieldType := field.Type()
+	resolvers := g.Resolvers
+	for _, resolve := range g.ObjectResolvers {
+		resolve := resolve
+		resolvers = append(resolvers[:len(resolvers):len(resolvers)],
+			func(field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error) {
+				return resolve(o, field, fieldType)
+			})
+	}
+	for _, resolve := range resolvers {
+		value, handled, err := resolve(structField, fieldType)
+		if err != nil {
+			return false, fmt.Errorf(
+				"failed to resolve field %s in type %s: %w",
+				structField.Name,
+				o.reflectType,
+				err,
+			)
+		}
+		if !handled {
+			continue
+		}
+
+		if !value.IsValid() {
+			value = reflect.Zero(fieldType)
+		}
+		if !value.Type().AssignableTo(fieldType) {
+			return false, fmt.Errorf(
+				"resolved value of type %s is not assignable to field %s (%s) in type %s",
+				value.Type(),
+				structField.Name,
+				fieldType,
+				o.reflectType,
+			)
+		}
+
+		field.Set(value)
+		if g.Logger != nil {
+			g.Logger.Debugf(
+				"assigned resolved value to field %s in %s",
+				structField.Name,
+				o,
+			)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// populateValue sets the field from the graph's Values by key.
+func (g *Graph) populateValue(o *Object, field reflect.Value, fieldName, key string) error {
+	value, ok := g.Values[key]
+	if !ok {
+		return fmt.Errorf(
+			"did not find value %s required by field %s in type %s",
+			key,
+			fieldName,
+			o.reflectType,
+		)
+	}
+
+	fieldType := field.Type()
+	if value == nil {
+		field.Set(reflect.Zero(fieldType))
+		return nil
+	}
+
+	valueType := reflect.TypeOf(value)
+	if !valueType.AssignableTo(fieldType) {
+		return fmt.Errorf(
+			"value %s of type %s is not assignable to field %s (%s) in type %s",
+			key,
+			valueType,
+			fieldName,
+			fieldType,
+			o.reflectType,
+		)
+	}
+
+	field.Set(reflect.ValueOf(value))
+	if g.Logger != nil {
+		g.Logger.Debugf(
+			"assigned value %s to field %s in %s",
+			key,
+			fieldName,
+			o,
+		)
+	}
+	return nil
+}
+
+// populateNamedSlice fills a slice field with the named objects in the given
+// order. Every name must exist and be assignable to the slice element type.
+func (g *Graph) populateNamedSlice(o *Object, field reflect.Value, fieldName string, names []string) error {
+	fieldType := field.Type()
+	elemType := fieldType.Elem()
+	slice := reflect.MakeSlice(fieldType, 0, len(names))
+	deps := make([]*Object, 0, len(names))
+	for _, name := range names {
+		existing := g.named[name]
+		if existing == nil {
+			return fmt.Errorf(
+				"did not find object named %s required by field %s in type %s%s",
+				name,
+				fieldName,
+				o.reflectType,
+				g.suggestName(name),
+			)
+		}
+
+		if !existing.reflectType.AssignableTo(elemType) {
+			return fmt.Errorf(
+				"object named %s of type %s is not assignable to elements of field %s (%s) in type %s",
+				name,
+				existing.reflectType,
+				fieldName,
+				fieldType,
+				o.reflectType,
+			)
+		}
+
+		slice = reflect.Append(slice, reflect.ValueOf(existing.Value))
+		deps = append(deps, existing)
+	}
+
+	field.Set(slice)
+	for idx, existing := range deps {
+		if g.Logger != nil {
+			g.Logger.Debugf(
+				"assigned %s to field %s[%d] in %s",
+				existing,
+				fieldName,
+				idx,
+				o,
+			)
+		}
+		key := fmt.Sprintf("%s[%d]", fieldName, idx)
+		o.addDep(key, existing)
+		g.decide(o, key, ActionAssignedExisting, existing)
+	}
+	return nil
+}
+
+// isCollection reports whether the field collects every assignable object,
+// which is the case for an untagged slice or array of interfaces or struct
+// pointers, or an untagged map of those keyed by string.
+func isCollection(fieldType reflect.Type, tag *tag) bool {
+	if tag.Name != "" || tag.Private || tag.ValueKey != "" {
+		return false
+	}
+	switch fieldType.Kind() {
+	case reflect.Slice, reflect.Array:
+	case reflect.Map:
+		if fieldType.Key().Kind() != reflect.String {
+			return false
+		}
+	default:
+		return false
+	}
+	elemType := fieldType.Elem()
+	return elemType.Kind() == reflect.Interface || isStructPtr(elemType)
+}
+
+// populateCollection fills a slice field with every object assignable to its
+// element type: the non-private unnamed objects in the order they were
+// provided followed by the other named objects in the order they were
+// provided, as for arrays.
+// A map field is instead filled with every other named object assignable to
+// its element type, keyed by name, and an array field as described for
+// populateArray.
+func (g *Graph) populateCollection(o *Object, field reflect.Value, fieldName string) error {
+	fieldType := field.Type()
+	elemType := fieldType.Elem()
+	switch fieldType.Kind() {
+	case reflect.Map:
+		g.populateNamedCollection(o, field, fieldName)
+		return nil
+	case reflect.Array:
+		return g.populateArray(o, field, fieldName)
+	}
+	var members []*Object
+	for _, existing := range append(g.unnamedCandidates(), g.namedCandidates(o)...) {
+		if existing.reflectType.AssignableTo(elemType) {
+			members = append(members, existing)
+		}
+	}
+
+	slice := reflect.MakeSlice(fieldType, 0, len(members))
+	for _, existing := range members {
+		slice = reflect.Append(slice, reflect.ValueOf(existing.Value))
+	}
+	field.Set(slice)
+
+	for idx, existing := range members {
+		if g.Logger != nil {
+			g.Logger.Debugf(
+				"assigned existing %s to field %s[%d] in %s",
+				existing,
+				fieldName,
+				idx,
+				o,
+			)
+		}
+		key := fmt.Sprintf("%s[%d]", fieldName, idx)
+		o.addDep(key, existing)
+		g.decide(o, key, ActionAssignedExisting, existing)
+	}
+	return nil
+}
+
+// populateArray fills each element of an array field with a distinct object
+// assignable to its element type, taken from the non-private unnamed objects
+// in the order they were provided followed by the other named objects in the
+// order they were provided. It fails if there are fewer such objects than
+// elements.
+func (g *Graph) populateArray(o *Object, field reflect.Value, fieldName string) error {
+	fieldType := field.Type()
+	var members []*Object
+	for _, existing := range append(g.unnamedCandidates(), g.namedCandidates(o)...) {
+		if len(members) == fieldType.Len() {
+			break
+		}
+		if existing.reflectType.AssignableTo(fieldType.Elem()) {
+			members = append(members, existing)
+		}
+	}
+	if len(members) < fieldType.Len() {
+		return fmt.Errorf(
+			"found %d assignable values for array field %s (%s) in type %s",
+			len(members),
+			fieldName,
+			fieldType,
+			o.reflectType,
+		)
+	}
+
+	for idx, existing := range members {
+		field.Index(idx).Set(reflect.ValueOf(existing.Value))
+		if g.Logger != nil {
+			g.Logger.Debugf(
+				"assigned existing %s to field %s[%d] in %s",
+				existing,
+				fieldName,
+				idx,
+				o,
+			)
+		}
+		key := fmt.Sprintf("%s[%d]", fieldName, idx)
+		o.addDep(key, existing)
+		g.decide(o, key, ActionAssignedExisting, existing)
+	}
+	return nil
+}
+
+// populateNamedCollection fills a map field with the named objects other than
+// o that are assignable to its element type, keyed by name.
+func (g *Graph) populateNamedCollection(o *Object, field reflect.Value, fieldName string) {
+	fieldType := field.Type()
+	m := reflect.MakeMap(fieldType)
+	for _, existing := range g.namedCandidates(o) {
+		if !existing.reflectType.AssignableTo(fieldType.Elem()) {
+			continue
+		}
+		m.SetMapIndex(reflect.ValueOf(existing.Name).Convert(fieldType.Key()), reflect.ValueOf(existing.Value))
+		if g.Logger != nil {
+			g.Logger.Debugf(
+				"assigned existing %s to field %s[%s] in %s",
+				existing,
+				fieldName,
+				existing.Name,
+				o,
+			)
+		}
+		key := fmt.Sprintf("%s[%s]", fieldName, existing.Name)
+		o.addDep(key, existing)
+		g.decide(o, key, ActionAssignedExisting, existing)
+	}
+	field.Set(m)
+}
+
+func (g *Graph) populateUnnamedInterface(o *Object) error {
+	// Ignore named value types.
+	if o.Name != "" && !isStructPtr(o.reflectType) {
+		return nil
+	}
+
+	for i := 0; i < o.reflectValue.Elem().NumField(); i++ {
+		field := o.reflectValue.Elem().Field(i)
+		fieldType := field.Type()
+		fieldTag := o.reflectType.Elem().Field(i).Tag
+		fieldName := o.reflectType.Elem().Field(i).Name
+		tag, err := g.parseTagCached(fieldTag)
+		if err != nil {
+			// Check if it's a malformed tag error and format accordingly
+			if errors.Is(err, ErrMalformedTag) {
+				return fmt.Errorf(
+					"unexpected tag format `%s` for field %s in type %s",
+					string(fieldTag),
+					o.reflectType.Elem().Field(i).Name,
+					o.reflectType,
+				)
+			}
+			return fmt.Errorf(
+				"unexpected tag format `%s` for field %s in type %s: %w",
+				string(fieldTag),
+				o.reflectType.Elem().Field(i).Name,
+				o.reflectType,
+				err,
+			)
+		}
+
+		// Skip fields without a tag.
+		if tag == nil {
+			continue
+		}
+
+		// We only handle interface and collection injection here. Other cases
+		// including errors are handled in the first pass when we inject pointers.
+		if fieldType.Kind() != reflect.Interface && !isCollection(fieldType, tag) {
+			continue
+		}
+
+		// Interface injection can't be private because we can't instantiate new
+		// instances of an interface.
+		if tag.Private {
+			return fmt.Errorf(
+				"found private inject tag on interface field %s in type %s",
+				o.reflectType.Elem().Field(i).Name,
+				o.reflectType,
+			)
+		}
+
+		// Don't overwrite existing values, unless forced.
+		if !tag.Force && !isNilOrZero(field, fieldType) {
+			continue
+		}
+
+		// Values must have already been handled in populateExplicit.
+		if tag.ValueKey != "" {
+			continue
+		}
+
+		// Named injects must have already been handled in populateExplicit,
+		// except for type references selecting an implementation.
+		if tag.Name != "" {
+			if g.named[tag.Name] == nil && g.isTypeReference(o, tag.Name) {
+				if err := g.populateByTypeName(o, field, fieldName, tag.Name, tag.Optional); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if isCollection(fieldType, tag) {
+			if err := g.populateCollection(o, field, fieldName); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// An interface bound to an object by name doesn't need resolving,
+		// unless that object is o itself.
+		if name, ok := g.Bindings[fieldType]; ok && o.Name != name {
+			if err := g.populateBound(o, field, fieldName, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Find one, and only one assignable value for the field among the
+		// unnamed and named objects alike. For interfaces, we need to check all
+		// objects since type index only has concrete types.
+		found, other := assignableTo(append(g.unnamedCandidates(), g.namedCandidates(o)...), fieldType)
+		if other != nil {
+			// Prefer a named object matching the field name before giving up
+			// on the ambiguity.
+			named := g.namedForField(fieldName, fieldType)
+			if named == nil {
+				return fmt.Errorf(
+					"found two assignable values for field %s in type %s. one type "+
+						"%s with value %v and another type %s with value %v",
+					o.reflectType.Elem().Field(i).Name,
+					o.reflectType,
+					found.reflectType,
+					found.Value,
+					other.reflectType,
+					other.reflectValue,
+				)
+			}
+			found = named
+		}
+
+		if found != nil {
+			field.Set(reflect.ValueOf(found.Value))
+			if g.Logger != nil {
+				g.Logger.Debugf(
+					"assigned existing %s to interface field %s in %s",
+					found,
+					o.reflectType.Elem().Field(i).Name,
+					o,
+				)
+			}
+			o.addDep(fieldName, found)
+			g.decide(o, fieldName, ActionAssignedInterface, found)
+		}
+
+		// Otherwise an adapter may turn another object into one.
+		if found == nil {
+			if existing, adapt := g.findAdaptable(o, fieldType); existing != nil {
+				if err := g.populateAdapted(o, field, fieldName, existing, adapt); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		// If we didn't find an assignable value, we're missing something.
+		if found == nil && !tag.Optional {
+			return fmt.Errorf(
+				"found no assignable value for field %s in type %s (%s)",
+				o.reflectType.Elem().Field(i).Name,
+				o.reflectType,
+				g.availableTypes(o, fieldType),
+			)
+		}
+	}
+	return nil
+}
+
+// availableTypes describes the objects that were considered for an interface
+// field of type t in o, for use in the error when none fit: the types of the
+// unnamed objects, then the named objects by name and type.
+func (g *Graph) availableTypes(o *Object, t reflect.Type) string {
+	var types []string
+	seen := make(map[reflect.Type]bool)
+	for _, existing := range g.unnamedCandidates() {
+		if existing == o || seen[existing.reflectType] {
+			continue
+		}
+		seen[existing.reflectType] = true
+		types = append(types, existing.reflectType.String())
+	}
+	for _, existing := range g.namedCandidates(o) {
+		types = append(types, fmt.Sprintf("%s (%s)", existing.Name, existing.reflectType))
+	}
+	if len(types) == 0 {
+		return "available: none"
+	}
+	return fmt.Sprintf("available: %s, none implement %s", strings.Join(types, ", "), t)
+}
+
+// populateBound sets the interface field of o to the object named name, which
+// its type is bound to in Bindings.
+func (g *Graph) populateBound(o *Object, field reflect.Value, fieldName, name string) error {
+	bound := g.named[name]
+	if bound == nil {
+		return fmt.Errorf(
+			"did not find object named %s bound to %s required by field %s in type %s",
+			name,
+			field.Type(),
+			fieldName,
+			o.reflectType,
+		)
+	}
+	if !bound.reflectType.AssignableTo(field.Type()) {
+		return fmt.Errorf(
+			"object named %s of type %s bound to %s is not assignable to field %s in type %s",
+			name,
+			bound.reflectType,
+			field.Type(),
+			fieldName,
+			o.reflectType,
+		)
+	}
+
+	field.Set(reflect.ValueOf(bound.Value))
+	if g.Logger != nil {
+		g.Logger.Debugf(
+			"assigned bound %s to interface field %s in %s",
+			bound,
+			fieldName,
+			o,
+		)
+	}
+	o.addDep(fieldName, bound)
+	g.decide(o, fieldName, ActionAssignedInterface, bound)
+	return nil
+}
+
+// adapter returns the first of the graph's Adapters matching from and to, or
+// nil if there is none.
+func (g *Graph) adapter(from, to reflect.Type) func(interface{}) interface{} {
+	for _, match := range g.Adapters {
+		if adapt, ok := match(from, to); ok && adapt != nil {
+			return adapt
+		}
+	}
+	return nil
+}
+
+// findAdaptable returns the first object, other than o, that an adapter can
+// turn into a value assignable to t, along with that adapter. Unnamed objects
+// are considered before named ones.
+func (g *Graph) findAdaptable(o *Object, t reflect.Type) (*Object, func(interface{}) interface{}) {
+	if len(g.Adapters) == 0 {
+		return nil, nil
+	}
+	for _, existing := range append(g.unnamedCandidates(), g.namedCandidates(o)...) {
+		if existing == o {
+			continue
+		}
+		if adapt := g.adapter(existing.reflectType, t); adapt != nil {
+			return existing, adapt
+		}
+	}
+	return nil, nil
+}
+
+// populateAdapted assigns the value adapt makes of existing to the field of o.
+func (g *Graph) populateAdapted(o *Object, field reflect.Value, fieldName string, existing *Object, adapt func(interface{}) interface{}) error {
+	adapted := adapt(existing.Value)
+	value := reflect.ValueOf(adapted)
+	if !value.IsValid() || !value.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf(
+			"adapter from %s returned %#v which is not assignable to field %s (%s) in type %s",
+			existing.reflectType,
+			adapted,
+			fieldName,
+			field.Type(),
+			o.reflectType,
+		)
+	}
+
+	field.Set(value)
+	if g.Logger != nil {
+		g.Logger.Debugf(
+			"assigned adapted %s to field %s in %s",
+			existing,
+			fieldName,
+			o,
+		)
+	}
+	o.addDep(fieldName, existing)
+	g.decide(o, fieldName, ActionAssignedExisting, existing)
+	return nil
+}
+
+// isTypeReference reports whether a tag name on a field of o refers to a
+// type rather than to a named object: it starts with "*", like "*pkg.Type",
+// or it is the package qualified type of an object that may fill the field,
+// like "pkg.Type". Other dotted names, such as "db.primary", are names.
+func (g *Graph) isTypeReference(o *Object, name string) bool {
+	if strings.HasPrefix(name, "*") {
+		return true
+	}
+	if !strings.Contains(name, ".") {
+		return false
+	}
+	for _, existing := range append(g.unnamedCandidates(), g.namedCandidates(o)...) {
+		if existing.reflectType.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// populateByTypeName assigns the one object whose type is named typeName to
+// an interface field of o. An optional field is left alone if there is none.
+func (g *Graph) populateByTypeName(o *Object, field reflect.Value, fieldName, typeName string, optional bool) error {
+	var found *Object
+	for _, existing := range append(g.unnamedCandidates(), g.namedCandidates(o)...) {
+		if existing.reflectType.String() != typeName {
+			continue
+		}
+		if found != nil {
 			return fmt.Errorf(
-				"unexpected tag format `%s` for field %s in type %s: %w",
-				string(fieldTag),
-				o.reflectType.Elem().Field(i).Name,
+				"found two objects of type %s required by field %s in type %s",
+				typeName,
+				fieldName,
 				o.reflectType,
-				err,
 			)
 		}
+		found = existing
+	}
+
+	if found == nil && optional {
+		return nil
+	}
+	if found == nil {
+		return fmt.Errorf(
+			"did not find object of type %s required by field %s in type %s",
+			typeName,
+			fieldName,
+			o.reflectType,
+		)
+	}
+	if !found.reflectType.AssignableTo(field.Type()) {
+		return fmt.Errorf(
+			"object of type %s is not assignable to field %s (%s) in type %s",
+			typeName,
+			fieldName,
+			field.Type(),
+			o.reflectType,
+		)
+	}
+
+	field.Set(reflect.ValueOf(found.Value))
+	if g.Logger != nil {
+		g.Logger.Debugf(
+			"assigned existing %s to interface field %s in %s",
+			found,
+			fieldName,
+			o,
+		)
+	}
+	o.addDep(fieldName, found)
+	g.decide(o, fieldName, ActionAssignedInterface, found)
+	return nil
+}
+
+// unnamedCandidates returns the non-private unnamed objects, which may
+// satisfy an untagged interface field.
+func (g *Graph) unnamedCandidates() []*Object {
+	candidates := make([]*Object, 0, len(g.unnamed))
+	for _, existing := range g.unnamed {
+		if !existing.private {
+			candidates = append(candidates, existing)
+		}
+	}
+	return candidates
+}
 
-		// Skip fields without a tag.
-		if tag == nil {
-			continue
+// namedCandidates returns the named objects in the order they were provided,
+// which may satisfy an untagged interface field of o. A named object never
+// satisfies its own fields, so that a registered service can wrap another
+// implementation of an interface it implements itself.
+func (g *Graph) namedCandidates(o *Object) []*Object {
+	candidates := make([]*Object, 0, len(g.namedOrder))
+	for _, existing := range g.namedOrder {
+		if existing != o {
+			candidates = append(candidates, existing)
 		}
+	}
+	return candidates
+}
 
-		// We only handle interface injection here. Other cases including errors
-		// are handled in the first pass when we inject pointers.
-		if fieldType.Kind() != reflect.Interface {
+// assignableTo returns the first candidate assignable to t and, if there is
+// one, a second assignable candidate so the caller can report the ambiguity.
+func assignableTo(candidates []*Object, t reflect.Type) (found, other *Object) {
+	for _, existing := range candidates {
+		if !existing.reflectType.AssignableTo(t) {
 			continue
 		}
+		if found != nil {
+			return found, existing
+		}
+		found = existing
+	}
+	return found, nil
+}
 
-		// Interface injection can't be private because we can't instantiate new
-		// instances of an interface.
-		if tag.Private {
-			return fmt.Errorf(
-				"found private inject tag on interface field %s in type %s",
-				o.reflectType.Elem().Field(i).Name,
-				o.reflectType,
-			)
+// findAssignable returns the non-private unnamed object assignable to t, or
+// nil if there is none. An object of exactly type t is preferred. Otherwise,
+// if several objects of different types are assignable, the first two are
+// returned so the caller can report the ambiguity.
+func (g *Graph) findAssignable(t reflect.Type) (found, other *Object) {
+	// Build type index if not already built
+	if g.typeIndex == nil {
+		g.buildTypeIndex()
+	}
+
+	// Try direct type match first (fastest path)
+	for _, existing := range g.typeIndex[t] {
+		if !existing.private {
+			return existing, nil
 		}
+	}
 
-		// Don't overwrite existing values.
-		if !isNilOrZero(field, fieldType) {
+	// Fallback to checking all objects if direct match failed (for interface types)
+	for _, existing := range g.unnamed {
+		if existing.private {
 			continue
 		}
+		if existing.reflectType.AssignableTo(t) {
+			if found != nil {
+				return found, existing
+			}
+			found = existing
+		}
+	}
+	return found, nil
+}
 
-		// Named injects must have already been handled in populateExplicit.
-		if tag.Name != "" {
-			panic(fmt.Sprintf("unhandled named instance with name %s", tag.Name))
+// CanResolve reports whether the graph currently has exactly one object that
+// an untagged field of type t would be assigned: a non-private unnamed object
+// for pointers, and a non-private unnamed or a named object for interfaces.
+// It uses the same lookup as Populate, so callers can conditionally provide
+// fallbacks before populating.
+func (g *Graph) CanResolve(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface {
+		found, other := assignableTo(append(g.unnamedCandidates(), g.namedCandidates(nil)...), t)
+		return found != nil && other == nil
+	}
+	found, other := g.findAssignable(t)
+	return found != nil && other == nil
+}
+
+// PlanAction describes what Populate would do for a field.
+type PlanAction int
+
+const (
+	// PlanAssignExisting means an existing object would be assigned.
+	PlanAssignExisting PlanAction = iota
+	// PlanCreateNew means a new object would be created and assigned.
+	PlanCreateNew
+	// PlanUnresolved means the field could not be wired.
+	PlanUnresolved
+)
+
+func (a PlanAction) String() string {
+	switch a {
+	case PlanAssignExisting:
+		return "existing"
+	case PlanCreateNew:
+		return "create"
+	default:
+		return "unresolved"
+	}
+}
+
+// PlanEntry describes what Populate would do for a single field.
+type PlanEntry struct {
+	Type       reflect.Type // Type of the object holding the field
+	Name       string       // Name of the object holding the field, if any
+	Field      string
+	Action     PlanAction
+	Dependency reflect.Type // Type of the object assigned or created, nil if unresolved
+}
+
+// planned is an object Populate would wire, either incomplete or to be
+// created, in which case object is nil.
+type planned struct {
+	typ    reflect.Type
+	name   string
+	object *Object
+}
+
+// Plan reports what Populate would do for the pointer, interface and named
+// fields of the incomplete objects, and of the objects it would create,
+// without changing the graph. Fields that are already set, handled by custom
+// resolvers, values or collections are not reported. Objects are visited
+// named first, sorted by name, followed by the unnamed objects.
+func (g *Graph) Plan() ([]PlanEntry, error) {
+	var queue []planned
+	for _, name := range g.names() {
+		if o := g.named[name]; !o.Complete && !o.isPlaceholder() && isStructPtr(o.reflectType) {
+			queue = append(queue, planned{typ: o.reflectType, name: name, object: o})
+		}
+	}
+	for _, o := range g.unnamed {
+		if !o.Complete && !o.embedded && !o.isPlaceholder() {
+			queue = append(queue, planned{typ: o.reflectType, object: o})
+		}
+	}
+	// Objects to be created are only planned once per type, which also
+	// guards against types that contain themselves.
+	enqueued := make(map[reflect.Type]bool)
+	create := func(t reflect.Type) {
+		if !enqueued[t] {
+			enqueued[t] = true
+			queue = append(queue, planned{typ: t})
+		}
+	}
+
+	// Unnamed non-private objects the plan creates, which satisfy later
+	// fields like the ones already in the graph.
+	var created []reflect.Type
+	createdType := make(map[reflect.Type]bool)
+	var entries []PlanEntry
+	for i := 0; i < len(queue); i++ {
+		p := queue[i]
+		instance := reflect.New(p.typ.Elem()).Elem()
+		if p.object != nil {
+			instance = p.object.reflectValue.Elem()
 		}
 
-		// Find one, and only one assignable value for the field.
-		// For interfaces, we need to check all objects since type index only has concrete types.
-		var found *Object
-		for _, existing := range g.unnamed {
-			if existing.private {
+		for f := 0; f < p.typ.Elem().NumField(); f++ {
+			structField := p.typ.Elem().Field(f)
+			fieldType := structField.Type
+			tag, err := g.parseTagCached(structField.Tag)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"unexpected tag format `%s` for field %s in type %s",
+					string(structField.Tag),
+					structField.Name,
+					p.typ,
+				)
+			}
+			if tag == nil || tag.ValueKey != "" || tag.Self || isCollection(fieldType, tag) {
+				continue
+			}
+			if !tag.Force && !isNilOrZero(instance.Field(f), fieldType) {
 				continue
 			}
-			if existing.reflectType.AssignableTo(fieldType) {
+
+			entry := PlanEntry{Type: p.typ, Name: p.name, Field: structField.Name, Action: PlanUnresolved}
+			switch {
+			case tag.Name != "":
+				existing := g.named[tag.Name]
+				switch {
+				case existing != nil && existing.reflectType.AssignableTo(fieldType):
+					entry.Action, entry.Dependency = PlanAssignExisting, existing.reflectType
+				case existing == nil && fieldType.Kind() == reflect.Interface && g.isTypeReference(p.object, tag.Name):
+					for _, candidate := range append(g.unnamedCandidates(), g.namedCandidates(p.object)...) {
+						if candidate.reflectType.String() == tag.Name && candidate.reflectType.AssignableTo(fieldType) {
+							entry.Action, entry.Dependency = PlanAssignExisting, candidate.reflectType
+						}
+					}
+					if entry.Action == PlanUnresolved && tag.Optional {
+						continue
+					}
+				case existing == nil && tag.Optional && !tag.Default:
+					continue
+				case existing == nil && tag.Optional && isStructPtr(fieldType):
+					entry.Action, entry.Dependency = PlanCreateNew, fieldType
+					create(fieldType)
+				}
+
+			case fieldType.Kind() == reflect.Interface:
+				if tag.Private {
+					break
+				}
+				found, other := assignableTo(append(g.unnamedCandidates(), g.namedCandidates(p.object)...), fieldType)
+				if other != nil {
+					found = g.namedForField(structField.Name, fieldType)
+				}
 				if found != nil {
-					return fmt.Errorf(
-						"found two assignable values for field %s in type %s. one type "+
-							"%s with value %v and another type %s with value %v",
-						o.reflectType.Elem().Field(i).Name,
-						o.reflectType,
-						found.reflectType,
-						found.Value,
-						existing.reflectType,
-						existing.reflectValue,
-					)
+					entry.Action, entry.Dependency = PlanAssignExisting, found.reflectType
+					break
 				}
-				found = existing
-				field.Set(reflect.ValueOf(existing.Value))
-				if g.Logger != nil {
-					g.Logger.Debugf(
-						"assigned existing %s to interface field %s in %s",
-						existing,
-						o.reflectType.Elem().Field(i).Name,
-						o,
-					)
+				for _, t := range created {
+					if t.AssignableTo(fieldType) {
+						entry.Action, entry.Dependency = PlanAssignExisting, t
+						break
+					}
 				}
-				o.addDep(fieldName, existing)
+				if entry.Action == PlanUnresolved && tag.Optional {
+					continue
+				}
+
+			case isStructPtr(fieldType):
+				if !tag.Private {
+					found, other := g.findAssignable(fieldType)
+					if other != nil {
+						break
+					}
+					if found != nil || createdType[fieldType] {
+						entry.Action, entry.Dependency = PlanAssignExisting, fieldType
+						if found != nil {
+							entry.Dependency = found.reflectType
+						}
+						break
+					}
+					if tag.Optional && !tag.Default {
+						continue
+					}
+				}
+				entry.Action, entry.Dependency = PlanCreateNew, fieldType
+				if !tag.Private && !tag.Optional {
+					createdType[fieldType] = true
+					created = append(created, fieldType)
+				}
+				create(fieldType)
+
+			default:
+				// Inline structs, maps and channels don't involve other objects.
+				continue
 			}
+			entries = append(entries, entry)
 		}
+	}
+	return entries, nil
+}
 
-		// If we didn't find an assignable value, we're missing something.
-		if found == nil {
-			return fmt.Errorf(
-				"found no assignable value for field %s in type %s",
-				o.reflectType.Elem().Field(i).Name,
-				o.reflectType,
-			)
+// namedForField returns the single named object whose name matches the field
+// name (case-insensitively) and is assignable to the field type, or nil if
+// there is no such object or more than one.
+func (g *Graph) namedForField(fieldName string, fieldType reflect.Type) *Object {
+	var match *Object
+	for name, existing := range g.named {
+		if !strings.EqualFold(name, fieldName) || !existing.reflectType.AssignableTo(fieldType) {
+			continue
 		}
+		if match != nil {
+			return nil
+		}
+		match = existing
 	}
-	return nil
+	return match
+}
+
+// suggestName returns a hint naming the named object closest to name, for
+// reporting likely typos, or an empty string if no name is close enough.
+func (g *Graph) suggestName(name string) string {
+	best, bestDistance := "", 3 // Suggest names at most two edits away.
+	for _, candidate := range g.names() {
+		if d := levenshtein(name, candidate); d < bestDistance && d < len(name) {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
 }
 
 // Objects returns all known objects, named as well as unnamed. The returned
@@ -554,6 +2330,140 @@ func (g *Graph) Objects() []*Object {
 	return objects
 }
 
+// Walk performs a depth-first traversal of the graph, invoking visit for each
+// object along with its depth. It starts from the named objects, sorted by
+// name, followed by the unnamed objects that were provided rather than
+// created, and descends through their Fields in field name order. Each object
+// is visited once, which also guards against cycles. The walk stops at the
+// first error returned by visit.
+func (g *Graph) Walk(visit func(o *Object, depth int) error) error {
+	names := make([]string, 0, len(g.named))
+	for name := range g.named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	roots := make([]*Object, 0, len(names)+len(g.unnamed))
+	for _, name := range names {
+		roots = append(roots, g.named[name])
+	}
+	for _, o := range g.unnamed {
+		if !o.created && !o.private {
+			roots = append(roots, o)
+		}
+	}
+
+	visited := make(map[*Object]bool)
+	var walk func(o *Object, depth int) error
+	walk = func(o *Object, depth int) error {
+		if visited[o] {
+			return nil
+		}
+		visited[o] = true
+		if err := visit(o, depth); err != nil {
+			return err
+		}
+
+		fields := make([]string, 0, len(o.Fields))
+		for field := range o.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if err := walk(o.Fields[field], depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, o := range roots {
+		if err := walk(o, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportedGraph is the JSON document written by ExportJSON.
+type exportedGraph struct {
+	Nodes []exportedNode `json:"nodes"`
+	Edges []exportedEdge `json:"edges"`
+}
+
+type exportedNode struct {
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Named   bool              `json:"named"`
+	Private bool              `json:"private"`
+	Created bool              `json:"created"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+type exportedEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Field string `json:"field"`
+}
+
+// ExportJSON writes the graph as a JSON document of nodes and edges. Nodes
+// are the named objects sorted by name followed by the unnamed objects in the
+// order they were provided. Nodes are identified by their Key. Edges follow
+// the Fields of each node in field name order.
+func (g *Graph) ExportJSON(w io.Writer) error {
+	names := make([]string, 0, len(g.named))
+	for name := range g.named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objects := make([]*Object, 0, len(g.named)+len(g.unnamed))
+	for _, name := range names {
+		if o := g.named[name]; !o.embedded {
+			objects = append(objects, o)
+		}
+	}
+	for _, o := range g.unnamed {
+		if !o.embedded {
+			objects = append(objects, o)
+		}
+	}
+
+	doc := exportedGraph{
+		Nodes: make([]exportedNode, 0, len(objects)),
+		Edges: []exportedEdge{},
+	}
+	for _, o := range objects {
+		doc.Nodes = append(doc.Nodes, exportedNode{
+			ID:      o.Key(),
+			Type:    fmt.Sprint(o.reflectType),
+			Named:   o.Name != "",
+			Private: o.private,
+			Created: o.created,
+			Tags:    o.Tags,
+		})
+	}
+
+	for _, o := range objects {
+		fields := make([]string, 0, len(o.Fields))
+		for field := range o.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			doc.Edges = append(doc.Edges, exportedEdge{
+				From:  o.Key(),
+				To:    o.Fields[field].Key(),
+				Field: field,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
 var (
 	injectOnly    = &tag{}
 	injectPrivate = &tag{Private: true}
@@ -561,9 +2471,23 @@ var (
 )
 
 type tag struct {
-	Name    string
-	Inline  bool
-	Private bool
+	Name      string
+	Inline    bool
+	Private   bool
+	Force     bool     // Inject even if the field already has a value
+	Optional  bool     // Leave the field alone if no provider is found
+	Default   bool     // With Optional, allocate a zero value if no provider is found
+	Names     []string // All names listed in the tag, used for slice fields
+	ValueKey  string   // Key into Graph.Values, from a "value:key" tag
+	SharedKey string   // Key shared by private injects, from a "private:key" tag
+	Self      bool     // Inject the name of the containing object, from a "self:name" tag
+	Buffer    int      // Buffer size of a private channel, from a "buf=N" option
+	HasBuffer bool     // Whether a "buf=N" option was given
+	Eager     bool     // Resolve a provider function's dependency during populate
+	Lazy      bool     // Resolve a provider function's dependency when first called
+	Complete  bool     // Mark the object assigned to a struct pointer field complete
+	Populate  bool     // Fill a private map with a created object per key in Keys
+	Keys      []string // Keys of a populated private map, from a "keys=a|b" option
 }
 
 // parseTag parses the inject tag from a struct tag string.
@@ -578,27 +2502,11 @@ func (g *Graph) parseTagCached(tagStr reflect.StructTag) (*tag, error) {
 		return cached, nil
 	}
 
-	// Validate tag format before parsing
-	// Check for malformed tags like `inject:` (colon with no value) or `inject:"` (unclosed quote)
+	// Validate tag format before parsing. Tags that don't mention inject are
+	// left alone so that malformed tags of other libraries are not our concern.
 	tagString := string(tagStr)
-	if strings.Contains(tagString, "inject:") {
-		// Check for malformed patterns:
-		// 1. Tag ends with just "inject:" (no value after colon)
-		// 2. Tag contains "inject:\"" but doesn't have a closing quote (not "inject:\"\"" or "inject:\"value\"")
-		if strings.HasSuffix(tagString, "inject:") {
-			// This is a malformed tag - return error
-			return nil, fmt.Errorf("malformed inject tag: %s", tagString)
-		}
-		// Check for unclosed quote: "inject:\"" without proper closing
-		if strings.Contains(tagString, "inject:\"") {
-			// Count quotes after "inject:\""
-			idx := strings.Index(tagString, "inject:\"")
-			remaining := tagString[idx+8:] // After "inject:\""
-			// If remaining doesn't contain a closing quote or is empty, it's malformed
-			if remaining == "" || (!strings.Contains(remaining, "\"") && !strings.Contains(remaining, " ")) {
-				return nil, fmt.Errorf("malformed inject tag: %s", tagString)
-			}
-		}
+	if strings.Contains(tagString, "inject") && !isWellFormedTag(tagString) {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedTag, tagString)
 	}
 
 	// Parse tag
@@ -617,17 +2525,161 @@ func (g *Graph) parseTagCached(tagStr reflect.StructTag) (*tag, error) {
 	case "private":
 		result = injectPrivate
 	default:
-		// Named dependency - value is the name
-		// Handle comma-separated values (e.g., "name,option")
-		parts := strings.Split(value, ",")
-		name := strings.TrimSpace(parts[0])
-		result = &tag{Name: name}
+		var err error
+		if result, err = parseTagValue(value); err != nil {
+			return nil, err
+		}
 	}
 
 	g.tagCache[tagStr] = result
 	return result, nil
 }
 
+// parseTagValue parses a comma-separated tag value of the form
+// "name,option,...". The first part is the name, or one of the "inline" and
+// "private" keywords. Parts that aren't options are collected as additional
+// names, which are only meaningful for slice fields.
+func parseTagValue(value string) (*tag, error) {
+	parts := strings.Split(value, ",")
+	result := &tag{}
+	switch name := strings.TrimSpace(parts[0]); name {
+	case "":
+	case "inline":
+		result.Inline = true
+	case "private":
+		result.Private = true
+	default:
+		if key, ok := strings.CutPrefix(name, "value:"); ok {
+			result.ValueKey = key
+			break
+		}
+		if name == "self:name" {
+			result.Self = true
+			break
+		}
+		if key, ok := strings.CutPrefix(name, "private:"); ok {
+			result.Private = true
+			result.SharedKey = key
+			break
+		}
+		// Named dependency - value is the name
+		result.Name = name
+		result.Names = []string{name}
+	}
+
+	for _, option := range parts[1:] {
+		switch option = strings.TrimSpace(option); option {
+		case "":
+		case "force":
+			result.Force = true
+		case "optional":
+			result.Optional = true
+		case "default":
+			result.Default = true
+		case "eager":
+			result.Eager = true
+		case "lazy":
+			result.Lazy = true
+		case "complete":
+			result.Complete = true
+		case "populate":
+			result.Populate = true
+		default:
+			if keys, ok := strings.CutPrefix(option, "keys="); ok {
+				for _, key := range strings.Split(keys, "|") {
+					key = strings.TrimSpace(key)
+					if key == "" || slices.Contains(result.Keys, key) {
+						return nil, fmt.Errorf("%w: invalid keys %q", ErrMalformedTag, keys)
+					}
+					result.Keys = append(result.Keys, key)
+				}
+				continue
+			}
+			if size, ok := strings.CutPrefix(option, "buf="); ok {
+				n, err := strconv.Atoi(size)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("%w: invalid buffer size %q", ErrMalformedTag, size)
+				}
+				result.Buffer = n
+				result.HasBuffer = true
+				continue
+			}
+			// Anything else lists further names for ordered slice injection.
+			if result.Name != "" {
+				result.Names = append(result.Names, option)
+			}
+		}
+	}
+	return result, nil
+}
+
+// isWellFormedTag reports whether the struct tag follows the conventional
+// `key:"value" key:"value"` grammar understood by reflect.StructTag, with
+// space separated pairs and at most one inject key.
+func isWellFormedTag(tag string) bool {
+	seenInject := false
+	for tag != "" {
+		// Skip leading space.
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+
+		// Scan to colon. A space, a quote or a control character is a syntax
+		// error.
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return false
+		}
+		name := tag[:i]
+		tag = tag[i+1:]
+
+		// Scan quoted string to find value.
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return false
+		}
+		if _, err := strconv.Unquote(tag[:i+1]); err != nil {
+			return false
+		}
+		tag = tag[i+1:]
+
+		// Pairs must be separated by a space.
+		if tag != "" && tag[0] != ' ' {
+			return false
+		}
+
+		if name == "inject" {
+			if seenInject {
+				return false
+			}
+			seenInject = true
+		}
+	}
+	return true
+}
+
+// ResetCaches discards the graph's cached parsed tags and type index, which
+// are rebuilt on demand. It is meant for tests and benchmarks measuring the
+// cold cost of populating; populating doesn't need it.
+func (g *Graph) ResetCaches() {
+	g.tagCache = nil
+	g.typeIndex = nil
+}
+
 // buildTypeIndex builds an index mapping types to objects that can be assigned to those types.
 // This enables faster lookups by pre-indexing objects by their concrete types.
 // Note: For interface types, we still need to check assignability during lookup,
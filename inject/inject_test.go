@@ -1,9 +1,14 @@
 package inject_test
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/tommynurwantoro/gontainer/inject"
@@ -84,7 +89,8 @@ func TestErrorOnNonPointerInject(t *testing.T) {
 		t.Fatalf("expected error for %+v", a)
 	}
 
-	const msg = "found inject tag on unsupported field A in type *inject_test.TypeWithNonPointerInject"
+	const msg = "found inject tag on unsupported field A in type *inject_test.TypeWithNonPointerInject: " +
+		"inject only supports pointer-to-struct, interface, map, or named value fields; got int"
 	if err.Error() != msg {
 		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
 	}
@@ -101,7 +107,124 @@ func TestErrorOnNonPointerStructInject(t *testing.T) {
 		t.Fatalf("expected error for %+v", a)
 	}
 
-	const msg = "found inject tag on unsupported field A in type *inject_test.TypeWithNonPointerStructInject"
+	const msg = "found inject tag on unsupported field A in type *inject_test.TypeWithNonPointerStructInject: " +
+		"inject only supports pointer-to-struct, interface, map, or named value fields; got *int"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithFuncInject struct {
+	A func(int) error `inject:""`
+}
+
+func TestErrorOnFuncInject(t *testing.T) {
+	var a TypeWithFuncInject
+	err := inject.Populate(&a)
+	if err == nil {
+		t.Fatalf("expected error for %+v", a)
+	}
+
+	const msg = "found inject tag on unsupported field A in type *inject_test.TypeWithFuncInject: " +
+		"inject only supports pointer-to-struct, interface, map, or named value fields; got func(int) error"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeThirdParty struct {
+	Client *TypeAnswerStruct `inject:""`
+}
+
+type TypeWithCompleteLeaf struct {
+	Leaf    *TypeThirdParty `inject:",complete"`
+	Private *TypeThirdParty `inject:"private,complete"`
+}
+
+func TestCompleteTagOnCreated(t *testing.T) {
+	var v TypeWithCompleteLeaf
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Leaf == nil || v.Private == nil || v.Leaf == v.Private {
+		t.Fatal("expected the leaves to be created")
+	}
+	if v.Leaf.Client != nil || v.Private.Client != nil {
+		t.Fatal("expected the fields of the leaves to stay nil")
+	}
+}
+
+func TestCompleteTagOnExisting(t *testing.T) {
+	var v TypeWithCompleteLeaf
+	leaf := &TypeThirdParty{}
+	err := inject.Populate(&v, leaf)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "complete requested on field Leaf in type *inject_test.TypeWithCompleteLeaf " +
+		"assigned the provided *inject_test.TypeThirdParty: only objects created for the field can be complete"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithCompleteNamed struct {
+	Leaf *TypeThirdParty `inject:"leaf,complete"`
+}
+
+func TestCompleteTagOnNamed(t *testing.T) {
+	var g inject.Graph
+	leaf := &TypeThirdParty{}
+	err := g.Provide(
+		&inject.Object{Value: &TypeWithCompleteNamed{}},
+		&inject.Object{Value: leaf, Name: "leaf"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "complete requested on field Leaf in type *inject_test.TypeWithCompleteNamed " +
+		"naming object leaf: only objects created for the field can be complete"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithSharedAndComplete struct {
+	Shared *TypeThirdParty `inject:""`
+	Leaf   *TypeThirdParty `inject:",complete"`
+}
+
+func TestCompleteTagLeavesSharedAlone(t *testing.T) {
+	var v TypeWithSharedAndComplete
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Shared == v.Leaf {
+		t.Fatal("expected the leaf to be created for its field")
+	}
+	if v.Shared.Client == nil || v.Leaf.Client != nil {
+		t.Fatal("expected only the leaf to be left unpopulated")
+	}
+}
+
+type TypeWithCompleteNonStruct struct {
+	A *int `inject:",complete"`
+}
+
+func TestCompleteTagOnNonStruct(t *testing.T) {
+	var v TypeWithCompleteNonStruct
+	err := inject.Populate(&v)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "complete requested on non struct pointer field A in type *inject_test.TypeWithCompleteNonStruct"
 	if err.Error() != msg {
 		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
 	}
@@ -415,7 +538,33 @@ func TestInjectInterfaceMissing(t *testing.T) {
 		t.Fatal("did not find expected error")
 	}
 
-	const msg = "found no assignable value for field Answerable in type *inject_test.TypeInjectInterfaceMissing"
+	const msg = "found no assignable value for field Answerable in type *inject_test.TypeInjectInterfaceMissing (available: none)"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestInjectInterfaceMissingListsAvailable(t *testing.T) {
+	var g inject.Graph
+	var v TypeInjectInterfaceMissing
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeForWalkLeaf{}},
+		&inject.Object{Value: &TypeForWalkMiddle{}},
+		&inject.Object{Value: &TypeForWalkLeaf{}, Name: "named"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "found no assignable value for field Answerable in type *inject_test.TypeInjectInterfaceMissing " +
+		"(available: *inject_test.TypeForWalkLeaf, *inject_test.TypeForWalkMiddle, " +
+		"named (*inject_test.TypeForWalkLeaf), none implement inject_test.Answerable)"
 	if err.Error() != msg {
 		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
 	}
@@ -463,7 +612,7 @@ func TestInvalidNamedInstanceType(t *testing.T) {
 		t.Fatal("did not find expected error")
 	}
 
-	const msg = "object named foo of type *inject_test.TypeNestedStruct is not assignable to field A (*inject_test.TypeAnswerStruct) in type *inject_test.TypeWithInvalidNamedType"
+	const msg = "object named foo of type *inject_test.TypeAnswerStruct is not assignable to field A (*inject_test.TypeNestedStruct) in type *inject_test.TypeWithInvalidNamedType"
 	if err.Error() != msg {
 		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
 	}
@@ -491,13 +640,13 @@ type TypeWithInjectOnPrivateInterfaceField struct {
 }
 
 func TestInjectOnPrivateInterfaceField(t *testing.T) {
-	var a TypeWithInjectOnPrivateField
+	var a TypeWithInjectOnPrivateInterfaceField
 	err := inject.Populate(&a)
 	if err == nil {
 		t.Fatal("did not find expected error")
 	}
 
-	const msg = "inject requested on unexported field a in type *inject_test.TypeWithInjectOnPrivateField"
+	const msg = "inject requested on unexported field a in type *inject_test.TypeWithInjectOnPrivateInterfaceField"
 	if err.Error() != msg {
 		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
 	}
@@ -831,7 +980,7 @@ func TestInjectMapWithoutPrivate(t *testing.T) {
 		t.Fatalf("expected error for %+v", v)
 	}
 
-	const msg = "inject on map field A in type *inject_test.TypeInjectWithMapWithoutPrivate must be named or private"
+	const msg = "inject on map field A in type *inject_test.TypeInjectWithMapWithoutPrivate must be named or private, or have string keys and interface or struct pointer values to collect named objects"
 	if err.Error() != msg {
 		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
 	}
@@ -932,10 +1081,14 @@ type TypeForLoggingCreated struct{}
 
 func (t TypeForLoggingCreated) Foo() {}
 
+// TypeForLoggingNamed doesn't implement TypeForLoggingInterface, so that the
+// interface field has a single candidate.
+type TypeForLoggingNamed struct{}
+
 type TypeForLoggingEmbedded struct {
 	TypeForLoggingCreated      *TypeForLoggingCreated  `inject:""`
 	TypeForLoggingInterface    TypeForLoggingInterface `inject:""`
-	TypeForLoggingCreatedNamed *TypeForLoggingCreated  `inject:"name_for_logging"`
+	TypeForLoggingCreatedNamed *TypeForLoggingNamed    `inject:"name_for_logging"`
 	Map                        map[string]string       `inject:"private"`
 }
 
@@ -948,13 +1101,13 @@ func TestInjectLogging(t *testing.T) {
 	g := inject.Graph{
 		Logger: &logger{
 			Expected: []string{
-				"provided *inject_test.TypeForLoggingCreated named name_for_logging",
+				"provided *inject_test.TypeForLoggingNamed named name_for_logging",
 				"provided *inject_test.TypeForLogging",
 				"provided embedded *inject_test.TypeForLoggingEmbedded",
 				"created *inject_test.TypeForLoggingCreated",
 				"assigned newly created *inject_test.TypeForLoggingCreated to field TypeForLoggingCreated in *inject_test.TypeForLogging",
 				"assigned existing *inject_test.TypeForLoggingCreated to field TypeForLoggingCreated in *inject_test.TypeForLoggingEmbedded",
-				"assigned *inject_test.TypeForLoggingCreated named name_for_logging to field TypeForLoggingCreatedNamed in *inject_test.TypeForLoggingEmbedded",
+				"assigned *inject_test.TypeForLoggingNamed named name_for_logging to field TypeForLoggingCreatedNamed in *inject_test.TypeForLoggingEmbedded",
 				"made map for field Map in *inject_test.TypeForLoggingEmbedded",
 				"assigned existing *inject_test.TypeForLoggingCreated to interface field TypeForLoggingInterface in *inject_test.TypeForLoggingEmbedded",
 			},
@@ -964,7 +1117,7 @@ func TestInjectLogging(t *testing.T) {
 	var v TypeForLogging
 
 	err := g.Provide(
-		&inject.Object{Value: &TypeForLoggingCreated{}, Name: "name_for_logging"},
+		&inject.Object{Value: &TypeForLoggingNamed{}, Name: "name_for_logging"},
 		&inject.Object{Value: &v},
 	)
 	if err != nil {
@@ -1019,3 +1172,2851 @@ func TestForSameNameButDifferentPackage(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type TypeStore interface {
+	Get() string
+}
+
+type TypeMemoryStore struct{}
+
+func (s *TypeMemoryStore) Get() string { return "memory" }
+
+type TypeRedisStore struct{}
+
+func (s *TypeRedisStore) Get() string { return "redis" }
+
+type TypeWithStore struct {
+	Store TypeStore `inject:""`
+}
+
+func TestInjectInterfacePrefersNamedFieldMatch(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	named := &TypeRedisStore{}
+	err := g.Provide(
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: &TypeRedisStore{}},
+		&inject.Object{Value: named, Name: "Store"},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != named {
+		t.Fatalf("expected the object named Store but got %T %p", v.Store, v.Store)
+	}
+}
+
+func TestInjectInterfaceNamedFieldMatchIsCaseInsensitive(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	named := &TypeMemoryStore{}
+	err := g.Provide(
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: &TypeRedisStore{}},
+		&inject.Object{Value: named, Name: "store"},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != named {
+		t.Fatalf("expected the object named store but got %T %p", v.Store, v.Store)
+	}
+}
+
+func TestInjectInterfaceAmbiguousWithoutNamedFieldMatch(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	err := g.Provide(
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: &TypeRedisStore{}},
+		&inject.Object{Value: &TypeRedisStore{}, Name: "cache"},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "found two assignable values for field Store in type *inject_test.TypeWithStore."
+	if !strings.HasPrefix(err.Error(), msg) {
+		t.Fatalf("expected prefix:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestCanResolve(t *testing.T) {
+	var g inject.Graph
+	if err := g.Provide(&inject.Object{Value: &TypeAnswerStruct{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !g.CanResolve(reflect.TypeOf(&TypeAnswerStruct{})) {
+		t.Fatal("expected concrete type to be resolvable")
+	}
+	if !g.CanResolve(reflect.TypeOf((*Answerable)(nil)).Elem()) {
+		t.Fatal("expected interface type to be resolvable")
+	}
+	if g.CanResolve(reflect.TypeOf(&TypeNestedStruct{})) {
+		t.Fatal("expected type without provider to be unresolvable")
+	}
+}
+
+func TestCanResolveIgnoresPrivate(t *testing.T) {
+	var g inject.Graph
+	var v struct {
+		A *TypeAnswerStruct `inject:"private"`
+	}
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if g.CanResolve(reflect.TypeOf(&TypeAnswerStruct{})) {
+		t.Fatal("expected private object to be ignored")
+	}
+}
+
+func TestCanResolveNamedInterface(t *testing.T) {
+	var g inject.Graph
+	iface := reflect.TypeOf((*Answerable)(nil)).Elem()
+	if err := g.Provide(&inject.Object{Value: &TypeAnswerStruct{}, Name: "answer"}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.CanResolve(iface) {
+		t.Fatal("expected a named implementation to resolve the interface")
+	}
+	if g.CanResolve(reflect.TypeOf(&TypeAnswerStruct{})) {
+		t.Fatal("expected named objects not to resolve pointer fields")
+	}
+
+	if err := g.Provide(&inject.Object{Value: &TypeNestedStruct{}}); err != nil {
+		t.Fatal(err)
+	}
+	if g.CanResolve(iface) {
+		t.Fatal("expected a named and an unnamed implementation to be ambiguous")
+	}
+}
+
+func TestCanResolveAfterProvide(t *testing.T) {
+	var g inject.Graph
+	typ := reflect.TypeOf(&TypeAnswerStruct{})
+	if g.CanResolve(typ) {
+		t.Fatal("expected empty graph to be unable to resolve")
+	}
+	if err := g.Provide(&inject.Object{Value: &TypeAnswerStruct{}}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.CanResolve(typ) {
+		t.Fatal("expected type provided after the first lookup to be resolvable")
+	}
+}
+
+func TestForceOverwritesExistingValue(t *testing.T) {
+	preset := &TypeAnswerStruct{}
+	var v struct {
+		A *TypeAnswerStruct `inject:""`
+		B *TypeAnswerStruct `inject:",force"`
+	}
+	v.A = preset
+	v.B = preset
+
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != preset {
+		t.Fatal("expected pre-set v.A to be preserved")
+	}
+	if v.B == preset {
+		t.Fatal("expected pre-set v.B to be overwritten")
+	}
+	if v.B == nil {
+		t.Fatal("v.B is nil")
+	}
+}
+
+func TestForceOverwritesNamedAndInterface(t *testing.T) {
+	var g inject.Graph
+	named := &TypeAnswerStruct{}
+	impl := &TypeMemoryStore{}
+	var v struct {
+		A *TypeAnswerStruct `inject:"foo,force"`
+		B TypeStore         `inject:",force"`
+	}
+	v.A = &TypeAnswerStruct{}
+	v.B = &TypeRedisStore{}
+
+	err := g.Provide(
+		&inject.Object{Value: named, Name: "foo"},
+		&inject.Object{Value: impl},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != named {
+		t.Fatal("expected v.A to be overwritten with the named object")
+	}
+	if v.B != impl {
+		t.Fatal("expected v.B to be overwritten with the interface implementation")
+	}
+}
+
+func TestPopulateStats(t *testing.T) {
+	g := inject.Graph{EnableStats: true}
+	var v struct {
+		A *TypeAnswerStruct `inject:""`
+		B *TypeNestedStruct `inject:""`
+	}
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := g.PopulateStats()
+	objects := g.Objects()
+	if len(stats) != len(objects) {
+		t.Fatalf("expected stats for %d objects, got %d", len(objects), len(stats))
+	}
+	for _, o := range objects {
+		d, ok := stats[o]
+		if !ok {
+			t.Fatalf("no duration recorded for %s", o)
+		}
+		if d < 0 {
+			t.Fatalf("negative duration %s recorded for %s", d, o)
+		}
+	}
+}
+
+func TestPopulateStatsDisabled(t *testing.T) {
+	var g inject.Graph
+	if err := g.Provide(&inject.Object{Value: &TypeNestedStruct{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(g.PopulateStats()); n != 0 {
+		t.Fatalf("expected no stats when disabled, got %d", n)
+	}
+}
+
+type TypeHandler interface {
+	Handle() string
+}
+
+type TypeHandlerImpl struct {
+	name string
+}
+
+func (h *TypeHandlerImpl) Handle() string { return h.name }
+
+func provideHandlers(t *testing.T, g *inject.Graph, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := g.Provide(&inject.Object{Value: &TypeHandlerImpl{name: name}, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInjectOrderedNamedSlice(t *testing.T) {
+	var g inject.Graph
+	provideHandlers(t, &g, "a", "b", "c")
+	var v struct {
+		Handlers []TypeHandler `inject:"c,a,b"`
+	}
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, h := range v.Handlers {
+		actual = append(actual, h.Handle())
+	}
+	expected := []string{"c", "a", "b"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+type TypeWithMissingNamedSlice struct {
+	Handlers []TypeHandler `inject:"a,missing"`
+}
+
+func TestInjectOrderedNamedSliceMissing(t *testing.T) {
+	var g inject.Graph
+	provideHandlers(t, &g, "a")
+	var v TypeWithMissingNamedSlice
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "did not find object named missing required by field Handlers in type *inject_test.TypeWithMissingNamedSlice"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithMismatchedNamedSlice struct {
+	Handlers []TypeHandler `inject:"a,answer"`
+}
+
+func TestInjectOrderedNamedSliceTypeMismatch(t *testing.T) {
+	var g inject.Graph
+	provideHandlers(t, &g, "a")
+	var v TypeWithMismatchedNamedSlice
+	err := g.Provide(
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "answer"},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "object named answer of type *inject_test.TypeAnswerStruct is not assignable to elements of field Handlers ([]inject_test.TypeHandler) in type *inject_test.TypeWithMismatchedNamedSlice"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestInjectNamedSliceValue(t *testing.T) {
+	var g inject.Graph
+	handlers := []TypeHandler{&TypeHandlerImpl{name: "x"}}
+	var v struct {
+		Handlers []TypeHandler `inject:"handlers"`
+	}
+	err := g.Provide(
+		&inject.Object{Value: handlers, Name: "handlers"},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Handlers) != 1 || v.Handlers[0] != handlers[0] {
+		t.Fatalf("expected the named slice value, got %v", v.Handlers)
+	}
+}
+
+type leveledLogger struct {
+	messages []string
+}
+
+func (l *leveledLogger) Debugf(f string, v ...interface{}) {
+	l.messages = append(l.messages, "debug: "+fmt.Sprintf(f, v...))
+}
+
+func (l *leveledLogger) Infof(f string, v ...interface{}) {
+	l.messages = append(l.messages, "info: "+fmt.Sprintf(f, v...))
+}
+
+func TestInjectLeveledLogging(t *testing.T) {
+	l := &leveledLogger{}
+	g := inject.Graph{Logger: l}
+	var v TypeNestedStruct
+
+	err := g.Provide(&inject.Object{Value: &v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"info: provided *inject_test.TypeNestedStruct",
+		"info: created *inject_test.TypeAnswerStruct",
+		"debug: assigned newly created *inject_test.TypeAnswerStruct to field A in *inject_test.TypeNestedStruct",
+	}
+	if !reflect.DeepEqual(l.messages, expected) {
+		t.Fatalf("expected:\n%v\nactual:\n%v", expected, l.messages)
+	}
+}
+
+type TypeWithValues struct {
+	MaxConns int    `inject:"value:maxConns"`
+	DSN      string `inject:"value:dsn"`
+}
+
+func TestInjectValues(t *testing.T) {
+	g := inject.Graph{Values: map[string]interface{}{"maxConns": 10, "dsn": "postgres://"}}
+	var v TypeWithValues
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.MaxConns != 10 {
+		t.Fatalf("expected v.MaxConns = 10 but got %d", v.MaxConns)
+	}
+	if v.DSN != "postgres://" {
+		t.Fatalf("expected v.DSN = postgres:// but got %s", v.DSN)
+	}
+}
+
+func TestInjectValueMissing(t *testing.T) {
+	g := inject.Graph{Values: map[string]interface{}{"maxConns": 10}}
+	var v TypeWithValues
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "did not find value dsn required by field DSN in type *inject_test.TypeWithValues"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestInjectValueTypeMismatch(t *testing.T) {
+	g := inject.Graph{Values: map[string]interface{}{"maxConns": "ten", "dsn": "postgres://"}}
+	var v TypeWithValues
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "value maxConns of type string is not assignable to field MaxConns (int) in type *inject_test.TypeWithValues"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func envResolver(env map[string]string) func(reflect.StructField, reflect.Type) (reflect.Value, bool, error) {
+	return func(field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error) {
+		key, ok := strings.CutPrefix(field.Tag.Get("inject"), "env:")
+		if !ok {
+			return reflect.Value{}, false, nil
+		}
+		value, ok := env[key]
+		if !ok {
+			return reflect.Value{}, false, fmt.Errorf("missing env %s", key)
+		}
+		return reflect.ValueOf(value), true, nil
+	}
+}
+
+func TestCustomResolver(t *testing.T) {
+	g := inject.Graph{
+		Resolvers: []func(reflect.StructField, reflect.Type) (reflect.Value, bool, error){
+			envResolver(map[string]string{"DB_URL": "postgres://db"}),
+		},
+	}
+	var v struct {
+		URL string            `inject:"env:DB_URL"`
+		A   *TypeAnswerStruct `inject:""`
+	}
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.URL != "postgres://db" {
+		t.Fatalf("expected v.URL = postgres://db but got %q", v.URL)
+	}
+	if v.A == nil {
+		t.Fatal("expected unhandled fields to use the built-in resolution")
+	}
+}
+
+type TypeWithMissingEnv struct {
+	URL string `inject:"env:DB_URL"`
+}
+
+func TestCustomResolverError(t *testing.T) {
+	g := inject.Graph{
+		Resolvers: []func(reflect.StructField, reflect.Type) (reflect.Value, bool, error){
+			envResolver(nil),
+		},
+	}
+	var v TypeWithMissingEnv
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "failed to resolve field URL in type *inject_test.TypeWithMissingEnv: missing env DB_URL"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestPrivateSharedKey(t *testing.T) {
+	var v struct {
+		A *TypeAnswerStruct `inject:"private:one"`
+		B *TypeAnswerStruct `inject:"private:one"`
+		C *TypeAnswerStruct `inject:"private:two"`
+		D *TypeNestedStruct `inject:"private:one"`
+		E *TypeAnswerStruct `inject:""`
+	}
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A == nil || v.C == nil || v.D == nil {
+		t.Fatal("expected keyed private fields to be populated")
+	}
+	if v.A != v.B {
+		t.Fatal("expected fields with the same key to share an instance")
+	}
+	if v.A == v.C {
+		t.Fatal("expected fields with different keys to get different instances")
+	}
+	if v.E == v.A || v.E == v.C {
+		t.Fatal("expected keyed private instances to stay private")
+	}
+}
+
+func TestPrivateSharedKeyAcrossObjects(t *testing.T) {
+	var g inject.Graph
+	var a, b struct {
+		A *TypeAnswerStruct `inject:"private:one"`
+	}
+	var named struct {
+		A *TypeAnswerStruct `inject:"private:one"`
+	}
+	err := g.Provide(
+		&inject.Object{Value: &a, Name: "a"},
+		&inject.Object{Value: &b, Name: "b"},
+		&inject.Object{Value: &named, Name: "named"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if a.A == nil || a.A != b.A || a.A != named.A {
+		t.Fatal("expected keyed private fields to share an instance within a populate pass")
+	}
+}
+
+func TestTagValidation(t *testing.T) {
+	cases := []struct {
+		tag       string
+		malformed bool
+	}{
+		{tag: `inject:""`},
+		{tag: `json:"a" inject:""`},
+		{tag: `inject:"" json:"inject:"`},
+		{tag: `xml:"inject:"`},
+		{tag: `inject:"" json:"a\"b"`},
+		{tag: `json:"injected"`},
+		{tag: `json:bad`},
+		{tag: `inject:`, malformed: true},
+		{tag: `inject:"`, malformed: true},
+		{tag: `inject:"a b`, malformed: true},
+		{tag: `inject:'a'`, malformed: true},
+		{tag: `inject:"a"inject:"b"`, malformed: true},
+		{tag: `inject:"a" inject:"b"`, malformed: true},
+		{tag: `inject:"a"json:"b"`, malformed: true},
+		{tag: `json:bad inject:""`, malformed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.tag, func(t *testing.T) {
+			typ := reflect.StructOf([]reflect.StructField{{
+				Name: "A",
+				Type: reflect.TypeOf(&TypeAnswerStruct{}),
+				Tag:  reflect.StructTag(c.tag),
+			}})
+			err := inject.Populate(reflect.New(typ).Interface())
+			if !c.malformed {
+				if err != nil {
+					t.Fatalf("expected well-formed tag to be accepted, got %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected malformed tag to be rejected")
+			}
+			msg := fmt.Sprintf("unexpected tag format `%s` for field A in type *%s", c.tag, typ)
+			if err.Error() != msg {
+				t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+			}
+		})
+	}
+}
+
+type TypeForWalkLeaf struct{}
+
+type TypeForWalkMiddle struct {
+	Leaf *TypeForWalkLeaf `inject:""`
+}
+
+type TypeForWalkRoot struct {
+	Middle *TypeForWalkMiddle `inject:""`
+	Shared *TypeForWalkLeaf   `inject:""`
+}
+
+func TestWalk(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeForWalkRoot{}, Name: "root"},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "answer"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	err = g.Walk(func(o *inject.Object, depth int) error {
+		actual = append(actual, fmt.Sprintf("%d %s", depth, o))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"0 *inject_test.TypeAnswerStruct named answer",
+		"0 *inject_test.TypeForWalkRoot named root",
+		"1 *inject_test.TypeForWalkMiddle",
+		"2 *inject_test.TypeForWalkLeaf",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected:\n%v\nactual:\n%v", expected, actual)
+	}
+}
+
+func TestWalkStopsOnError(t *testing.T) {
+	var g inject.Graph
+	if err := g.Provide(&inject.Object{Value: &TypeForWalkRoot{}, Name: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := fmt.Errorf("stop")
+	visits := 0
+	err := g.Walk(func(o *inject.Object, depth int) error {
+		visits++
+		if depth == 1 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected the visit error, got %v", err)
+	}
+	if visits != 2 {
+		t.Fatalf("expected the walk to stop after 2 visits, got %d", visits)
+	}
+}
+
+type TypeForWalkCycleA struct {
+	B *TypeForWalkCycleB `inject:""`
+}
+
+type TypeForWalkCycleB struct {
+	A *TypeForWalkCycleA `inject:""`
+}
+
+func TestWalkCycle(t *testing.T) {
+	var g inject.Graph
+	if err := g.Provide(&inject.Object{Value: &TypeForWalkCycleA{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	visits := 0
+	err := g.Walk(func(o *inject.Object, depth int) error {
+		visits++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visits != 2 {
+		t.Fatalf("expected 2 visits, got %d", visits)
+	}
+}
+
+type TypeWithPointerToInterface struct {
+	W *io.Writer `inject:""`
+}
+
+func TestInjectPointerToInterface(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithPointerToInterface
+	err := g.Provide(
+		&inject.Object{Value: &bytes.Buffer{}},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "inject on pointer to interface field W in type *inject_test.TypeWithPointerToInterface is not supported, use io.Writer instead"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithPointerToPointer struct {
+	A **TypeAnswerStruct `inject:""`
+}
+
+type TypeWithNamedPointerToPointer struct {
+	A **TypeAnswerStruct `inject:"answer"`
+}
+
+func TestErrorOnPointerToPointer(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeWithPointerToPointer{}},
+		&inject.Object{Value: &TypeAnswerStruct{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "inject on pointer to pointer field A in type *inject_test.TypeWithPointerToPointer is not supported, " +
+		"use *inject_test.TypeAnswerStruct instead"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestErrorOnNamedPointerToPointer(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeWithNamedPointerToPointer{}},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "answer"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "inject on pointer to pointer field A in type *inject_test.TypeWithNamedPointerToPointer is not supported, " +
+		"use *inject_test.TypeAnswerStruct instead"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeOtherAnswer struct{}
+
+func (t *TypeOtherAnswer) Answer() int { return 0 }
+
+func TestBindings(t *testing.T) {
+	var g inject.Graph
+	var v TypeInjectInterfaceMissing
+	other := &TypeOtherAnswer{}
+	g.Bindings = map[reflect.Type]string{reflect.TypeOf((*Answerable)(nil)).Elem(): "other"}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeAnswerStruct{}},
+		&inject.Object{Value: other, Name: "other"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Answerable != other {
+		t.Fatalf("expected the bound object, got %T", v.Answerable)
+	}
+}
+
+func TestBindingsNotAssignable(t *testing.T) {
+	var g inject.Graph
+	var v TypeInjectInterfaceMissing
+	g.Bindings = map[reflect.Type]string{reflect.TypeOf((*Answerable)(nil)).Elem(): "leaf"}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeForWalkLeaf{}, Name: "leaf"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "object named leaf of type *inject_test.TypeForWalkLeaf bound to inject_test.Answerable " +
+		"is not assignable to field Answerable in type *inject_test.TypeInjectInterfaceMissing"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeEmbeddedDeps struct {
+	A *TypeAnswerStruct `inject:""`
+	B Answerable        `inject:""`
+}
+
+type TypeWithEmbeddedDeps struct {
+	TypeEmbeddedDeps
+	Field TypeEmbeddedDeps
+}
+
+func TestAutoInline(t *testing.T) {
+	var g inject.Graph
+	g.AutoInline = true
+	var v TypeWithEmbeddedDeps
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.A == nil || v.B != v.A {
+		t.Fatal("expected the fields of the embedded struct to be populated")
+	}
+	if v.Field.A != nil || v.Field.B != nil {
+		t.Fatal("expected the fields of the named struct field to be left alone")
+	}
+}
+
+func TestAutoInlineDisabled(t *testing.T) {
+	var v TypeWithEmbeddedDeps
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != nil || v.B != nil {
+		t.Fatal("expected the embedded struct to be left alone without AutoInline")
+	}
+}
+
+type TypePlugin struct {
+	A *TypeAnswerStruct `inject:""`
+}
+
+type TypePluginRegistry struct {
+	Plugins map[string]*TypePlugin `inject:"private,populate,keys=http|grpc"`
+}
+
+func TestPopulateMapEntries(t *testing.T) {
+	var v TypePluginRegistry
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v.Plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %v", v.Plugins)
+	}
+	http, grpc := v.Plugins["http"], v.Plugins["grpc"]
+	if http == nil || grpc == nil || http == grpc {
+		t.Fatalf("expected a plugin of its own for each key, got %v", v.Plugins)
+	}
+	if http.A == nil || http.A != grpc.A {
+		t.Fatal("expected the plugins to be wired with the shared dependency")
+	}
+}
+
+type TypeWithPopulateOnSharedMap struct {
+	Plugins map[string]*TypePlugin `inject:"plugins,populate,keys=http"`
+}
+
+type TypeWithPopulateWithoutKeys struct {
+	Plugins map[string]*TypePlugin `inject:"private,populate"`
+}
+
+type TypeWithDuplicateKeys struct {
+	Plugins map[string]*TypePlugin `inject:"private,populate,keys=http|http"`
+}
+
+func TestPopulateMapEntriesErrors(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		msg   string
+	}{
+		{
+			&TypeWithPopulateOnSharedMap{},
+			"populate requested on field Plugins in type *inject_test.TypeWithPopulateOnSharedMap " +
+				"which is not a private map of struct pointers by string keys",
+		},
+		{
+			&TypeWithPopulateWithoutKeys{},
+			"populate and keys must be given together on map field Plugins in type *inject_test.TypeWithPopulateWithoutKeys",
+		},
+		{
+			&TypeWithDuplicateKeys{},
+			"unexpected tag format `inject:\"private,populate,keys=http|http\"` for field Plugins " +
+				"in type *inject_test.TypeWithDuplicateKeys",
+		},
+	}
+	for _, c := range cases {
+		err := inject.Populate(c.value)
+		if err == nil {
+			t.Fatal("did not find expected error")
+		}
+		if err.Error() != c.msg {
+			t.Fatalf("expected:\n%s\nactual:\n%s", c.msg, err.Error())
+		}
+	}
+}
+
+type TypeWithMissingNamedBar struct {
+	A *TypeAnswerStruct `inject:"bar"`
+}
+
+func TestPopulateAll(t *testing.T) {
+	var g inject.Graph
+	var missingFoo TypeWithMissingNamed
+	var missingBar TypeWithMissingNamedBar
+	var missingInterface TypeInjectInterfaceMissing
+	var ok TypeForWalkMiddle
+	err := g.Provide(
+		&inject.Object{Value: &missingFoo},
+		&inject.Object{Value: &missingBar, Name: "bar-user"},
+		&inject.Object{Value: &missingInterface},
+		&inject.Object{Value: &ok},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, err := range g.PopulateAll() {
+		actual = append(actual, err.Error())
+	}
+	sameElements(t, actual, []string{
+		"did not find object named foo required by field A in type *inject_test.TypeWithMissingNamed",
+		"did not find object named bar required by field A in type *inject_test.TypeWithMissingNamedBar",
+		"found no assignable value for field Answerable in type *inject_test.TypeInjectInterfaceMissing " +
+			"(available: *inject_test.TypeWithMissingNamed, *inject_test.TypeForWalkMiddle, " +
+			"*inject_test.TypeForWalkLeaf, bar-user (*inject_test.TypeWithMissingNamedBar), " +
+			"none implement inject_test.Answerable)",
+	})
+	if ok.Leaf == nil {
+		t.Fatal("expected objects without errors to be wired")
+	}
+}
+
+type TypeForDecisions struct {
+	Named   *TypeForWalkLeaf   `inject:"leaf"`
+	Created *TypeForWalkMiddle `inject:""`
+	Answer  Answerable         `inject:""`
+	Preset  *TypeAnswerStruct  `inject:""`
+}
+
+func TestPopulateVerbose(t *testing.T) {
+	var g inject.Graph
+	root := &TypeForDecisions{Preset: &TypeAnswerStruct{}}
+	err := g.Provide(
+		&inject.Object{Value: root, Name: "root"},
+		&inject.Object{Value: &TypeForWalkLeaf{}, Name: "leaf"},
+		&inject.Object{Value: &TypeAnswerStruct{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	err = g.PopulateVerbose(func(d inject.Decision) {
+		target := "<nil>"
+		if d.Target != nil {
+			target = d.Target.Key()
+		}
+		actual = append(actual, fmt.Sprintf("%s.%s %s %s", d.Object.Key(), d.Field, d.Action, target))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"root.Named assigned-existing leaf",
+		"root.Created created *inject_test.TypeForWalkMiddle",
+		"root.Preset skipped <nil>",
+		"*inject_test.TypeForWalkMiddle.Leaf created *inject_test.TypeForWalkLeaf",
+		"root.Answer assigned-interface *inject_test.TypeAnswerStruct",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected:\n%s\nactual:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestPopulateVerboseError(t *testing.T) {
+	var g inject.Graph
+	var v TypeInjectInterfaceMissing
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	var decisions []inject.Decision
+	err := g.PopulateVerbose(func(d inject.Decision) { decisions = append(decisions, d) })
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	if len(decisions) != 1 || decisions[0].Action != inject.ActionError || decisions[0].Err != err {
+		t.Fatalf("expected a single error decision, got %+v", decisions)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+type TypeForExport struct {
+	Root    *TypeForWalkRoot  `inject:"root"`
+	Private *TypeForWalkLeaf  `inject:"private"`
+	Nested  *TypeNestedStruct `inject:""`
+}
+
+func TestObjectTags(t *testing.T) {
+	var g inject.Graph
+	tags := map[string]string{"owner": "payments", "deprecated": "use v2"}
+	err := g.Provide(
+		&inject.Object{Value: &TypeForWalkRoot{}, Name: "root", Tags: tags},
+		&inject.Object{Value: &TypeForWalkLeaf{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, o := range g.Objects() {
+		if o.Name == "root" {
+			if !reflect.DeepEqual(o.Tags, map[string]string{"owner": "payments", "deprecated": "use v2"}) {
+				t.Fatalf("expected the tags to be left untouched, got %v", o.Tags)
+			}
+			continue
+		}
+		if o.Tags != nil {
+			t.Fatalf("expected no tags on %s, got %v", o, o.Tags)
+		}
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeForWalkRoot{}, Name: "root", Tags: map[string]string{"owner": "platform"}},
+		&inject.Object{Value: &TypeForExport{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := g.ExportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	const golden = "testdata/graph.golden.json"
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("expected:\n%s\nactual:\n%s", expected, buf.Bytes())
+	}
+}
+
+type TypeAnswerPtrA *TypeAnswerStruct
+
+type TypeAnswerPtrB *TypeAnswerStruct
+
+type TypeWithAmbiguousPointer struct {
+	A *TypeAnswerStruct `inject:""`
+}
+
+func TestInjectAmbiguousConcretePointer(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithAmbiguousPointer
+	err := g.Provide(
+		&inject.Object{Value: TypeAnswerPtrA(&TypeAnswerStruct{answer: 1})},
+		&inject.Object{Value: TypeAnswerPtrB(&TypeAnswerStruct{answer: 2})},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("was expecting error")
+	}
+
+	const msg = "found two assignable values for field A in type *inject_test.TypeWithAmbiguousPointer. one type inject_test.TypeAnswerPtrA with value &{1 0} and another type inject_test.TypeAnswerPtrB with value &{2 0}"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+	if g.CanResolve(reflect.TypeOf(&TypeAnswerStruct{})) {
+		t.Fatal("expected ambiguous type to be unresolvable")
+	}
+}
+
+func TestInjectExactPointerTypeWins(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithAmbiguousPointer
+	exact := &TypeAnswerStruct{}
+	err := g.Provide(
+		&inject.Object{Value: TypeAnswerPtrA(&TypeAnswerStruct{})},
+		&inject.Object{Value: exact},
+		&inject.Object{Value: &v},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != exact {
+		t.Fatal("expected the object of the exact field type to be injected")
+	}
+}
+
+func TestObjectAccessors(t *testing.T) {
+	var g inject.Graph
+	provided := &inject.Object{Value: &TypeForExport{}}
+	err := g.Provide(
+		&inject.Object{Value: &TypeForWalkRoot{}, Name: "root"},
+		provided,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provided.Type() != reflect.TypeOf(&TypeForExport{}) {
+		t.Fatalf("unexpected type %s", provided.Type())
+	}
+	if provided.IsPrivate() || provided.IsCreated() {
+		t.Fatal("expected provided object to be neither private nor created")
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	private := provided.Fields["Private"]
+	if private.Type() != reflect.TypeOf(&TypeForWalkLeaf{}) {
+		t.Fatalf("unexpected type %s", private.Type())
+	}
+	if !private.IsPrivate() || !private.IsCreated() {
+		t.Fatal("expected private dependency to be private and created")
+	}
+
+	nested := provided.Fields["Nested"]
+	if nested.IsPrivate() || !nested.IsCreated() {
+		t.Fatal("expected nested dependency to be shared and created")
+	}
+}
+
+type TypeMiddleware interface {
+	Wrap() string
+}
+
+type TypeMiddlewareA struct{}
+
+func (m *TypeMiddlewareA) Wrap() string { return "a" }
+
+type TypeMiddlewareB struct{}
+
+func (m *TypeMiddlewareB) Wrap() string { return "b" }
+
+type TypeMiddlewareC struct{}
+
+func (m *TypeMiddlewareC) Wrap() string { return "c" }
+
+type TypeWithMiddlewares struct {
+	Middlewares []TypeMiddleware `inject:""`
+}
+
+func TestInjectInterfaceCollection(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithMiddlewares
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMiddlewareB{}},
+		&inject.Object{Value: &TypeMiddlewareA{}},
+		&inject.Object{Value: &TypeMiddlewareC{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, m := range v.Middlewares {
+		actual = append(actual, m.Wrap())
+	}
+	expected := []string{"b", "a", "c"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestInjectInterfaceCollectionIncludesNamed(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithMiddlewares
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMiddlewareC{}, Name: "c"},
+		&inject.Object{Value: &TypeMiddlewareB{}},
+		&inject.Object{Value: &TypeMiddlewareA{}, Name: "a"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, m := range v.Middlewares {
+		actual = append(actual, m.Wrap())
+	}
+	expected := []string{"b", "c", "a"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+type TypeMiddlewareUser struct {
+	Middlewares []TypeMiddleware `inject:""`
+	Created     *TypeMiddlewareA `inject:""`
+}
+
+func TestInjectInterfaceCollectionIncludesCreated(t *testing.T) {
+	var v TypeMiddlewareUser
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Middlewares) != 1 || v.Middlewares[0] != v.Created {
+		t.Fatalf("expected the created middleware to be collected, got %v", v.Middlewares)
+	}
+}
+
+type answerable interface {
+	Answer() int
+}
+
+type TypeWithEmbeddedPrivateInterface struct {
+	answerable `inject:""`
+	A          *TypeAnswerStruct `inject:""`
+}
+
+// The first pass rejects the field, so the interface pass never sets it.
+func TestInjectOnEmbeddedPrivateInterfaceField(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithEmbeddedPrivateInterface
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := g.PopulateAll()
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly one error, got %v", errs)
+	}
+
+	const msg = "inject requested on unexported field answerable in type *inject_test.TypeWithEmbeddedPrivateInterface"
+	if errs[0].Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, errs[0].Error())
+	}
+}
+
+type TypeOptionalLeaf struct {
+	N int
+}
+
+type TypeWithOptional struct {
+	Leaf    *TypeOptionalLeaf `inject:",optional"`
+	Named   *TypeOptionalLeaf `inject:"leaf,optional"`
+	Store   TypeStore         `inject:",optional"`
+	Default *TypeOptionalLeaf `inject:",optional,default"`
+	Zero    *TypeOptionalLeaf `inject:"leaf,optional,default"`
+}
+
+func TestInjectOptionalMissing(t *testing.T) {
+	var v TypeWithOptional
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Leaf != nil {
+		t.Fatal("expected optional field to be left nil")
+	}
+	if v.Named != nil {
+		t.Fatal("expected optional named field to be left nil")
+	}
+	if v.Store != nil {
+		t.Fatal("expected optional interface field to be left nil")
+	}
+	if v.Default == nil {
+		t.Fatal("expected optional field with default to be allocated")
+	}
+	if v.Zero == nil {
+		t.Fatal("expected optional named field with default to be allocated")
+	}
+	if v.Default == v.Zero {
+		t.Fatal("expected default values to be private to their field")
+	}
+}
+
+func TestInjectOptionalProvided(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithOptional
+	leaf := &TypeOptionalLeaf{}
+	named := &TypeOptionalLeaf{}
+	store := &TypeMemoryStore{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: leaf},
+		&inject.Object{Value: named, Name: "leaf"},
+		&inject.Object{Value: store},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Leaf != leaf || v.Default != leaf {
+		t.Fatal("expected the provided value to be injected")
+	}
+	if v.Named != named || v.Zero != named {
+		t.Fatal("expected the provided named value to be injected")
+	}
+	if v.Store != store {
+		t.Fatal("expected the provided interface value to be injected")
+	}
+}
+
+type TypeForStats struct {
+	Named   *TypeForWalkLeaf   `inject:"leaf"`
+	Created *TypeForWalkMiddle `inject:""`
+	Private *TypeOptionalLeaf  `inject:"private"`
+}
+
+func TestStats(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeForStats{}},
+		&inject.Object{Value: &TypeForWalkLeaf{}, Name: "leaf"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// TypeForWalkMiddle is created, and so is the TypeForWalkLeaf it needs.
+	expected := inject.GraphStats{
+		NamedObjects:   1,
+		UnnamedObjects: 4,
+		CreatedObjects: 3,
+		PrivateObjects: 1,
+	}
+	if actual := g.Stats(); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+type TypeResolvedHandler struct {
+	Leaf  *TypeOptionalLeaf `inject:""`
+	Store TypeStore         `inject:""`
+}
+
+func (h *TypeResolvedHandler) Handle() string { return h.Store.Get() }
+
+func TestPopulateObjectsProvidedMidPass(t *testing.T) {
+	var g inject.Graph
+	// The resolver provides a named object that still needs both passes.
+	g.Resolvers = append(g.Resolvers, func(field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error) {
+		if field.Tag.Get("inject") != "resolved" {
+			return reflect.Value{}, false, nil
+		}
+		h := &TypeResolvedHandler{}
+		if err := g.Provide(&inject.Object{Value: h, Name: "resolved"}); err != nil {
+			return reflect.Value{}, false, err
+		}
+		return reflect.ValueOf(h), true, nil
+	})
+
+	var v struct {
+		Handler TypeHandler `inject:"resolved"`
+	}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := v.Handler.(*TypeResolvedHandler)
+	if h.Leaf == nil {
+		t.Fatal("expected the resolved object's pointer field to be injected")
+	}
+	if h.Handle() != "memory" {
+		t.Fatal("expected the resolved object's interface field to be injected")
+	}
+}
+
+type TypeWithSelfName struct {
+	Name string `inject:"self:name"`
+}
+
+func TestInjectSelfName(t *testing.T) {
+	var g inject.Graph
+	named := &TypeWithSelfName{}
+	unnamed := &TypeWithSelfName{}
+	err := g.Provide(
+		&inject.Object{Value: named, Name: "logger"},
+		&inject.Object{Value: unnamed},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if named.Name != "logger" {
+		t.Fatalf("expected named object to receive its name, got %q", named.Name)
+	}
+	if unnamed.Name != "" {
+		t.Fatalf("expected unnamed object to receive an empty name, got %q", unnamed.Name)
+	}
+}
+
+type TypeWithSelfNameOnInt struct {
+	Name int `inject:"self:name"`
+}
+
+func TestInjectSelfNameOnNonString(t *testing.T) {
+	var v TypeWithSelfNameOnInt
+	err := inject.Populate(&v)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "self:name requested on non string field Name in type *inject_test.TypeWithSelfNameOnInt"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestInjectNamedIntoUntaggedInterface(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	store := &TypeMemoryStore{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: store, Name: "store"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != store {
+		t.Fatal("expected the named implementation to be injected")
+	}
+}
+
+func TestInjectNamedAndUnnamedIntoUntaggedInterface(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: &TypeRedisStore{}, Name: "redis"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "found two assignable values for field Store in type *inject_test.TypeWithStore. " +
+		"one type *inject_test.TypeMemoryStore with value &{} and another type *inject_test.TypeRedisStore with value &{}"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestInjectNamedAndUnnamedByFieldName(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	store := &TypeRedisStore{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: store, Name: "Store"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != store {
+		t.Fatal("expected the object named after the field to break the tie")
+	}
+}
+
+func TestInjectTwoNamedIntoUntaggedInterface(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStore
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}, Name: "memory"},
+		&inject.Object{Value: &TypeRedisStore{}, Name: "redis"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "found two assignable values for field Store in type *inject_test.TypeWithStore. one type *inject_test.TypeMemoryStore with value &{} and another type *inject_test.TypeRedisStore with value &{}"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithStoreMap struct {
+	Stores map[string]TypeStore `inject:""`
+}
+
+func TestInjectMapCollectsNamed(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStoreMap
+	memory := &TypeMemoryStore{}
+	redis := &TypeRedisStore{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: memory, Name: "memory"},
+		&inject.Object{Value: redis, Name: "redis"},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "answer"},
+		&inject.Object{Value: &TypeMemoryStore{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]TypeStore{"memory": memory, "redis": redis}
+	if !reflect.DeepEqual(v.Stores, expected) {
+		t.Fatalf("expected %v, got %v", expected, v.Stores)
+	}
+}
+
+func TestInjectNamedMap(t *testing.T) {
+	var g inject.Graph
+	var v struct {
+		Stores map[string]TypeStore `inject:"stores"`
+	}
+	stores := map[string]TypeStore{"memory": &TypeMemoryStore{}}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: stores, Name: "stores"},
+		&inject.Object{Value: &TypeRedisStore{}, Name: "redis"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.Stores, stores) {
+		t.Fatalf("expected the named map, got %v", v.Stores)
+	}
+}
+
+type TypeInjectWithIntKeyedMap struct {
+	A map[int]TypeStore `inject:""`
+}
+
+func TestInjectMapWithNonStringKeys(t *testing.T) {
+	var a TypeInjectWithIntKeyedMap
+	err := inject.Populate(&a)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "inject on map field A in type *inject_test.TypeInjectWithIntKeyedMap must be named or private, or have string keys and interface or struct pointer values to collect named objects"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithPrivateChannels struct {
+	Unbuffered chan int    `inject:"private"`
+	Buffered   chan string `inject:"private,buf=16"`
+}
+
+func TestInjectPrivateChannels(t *testing.T) {
+	var v TypeWithPrivateChannels
+	if err := inject.Populate(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Unbuffered == nil || cap(v.Unbuffered) != 0 {
+		t.Fatalf("expected an unbuffered channel, got %v with capacity %d", v.Unbuffered, cap(v.Unbuffered))
+	}
+	if v.Buffered == nil || cap(v.Buffered) != 16 {
+		t.Fatalf("expected a channel with buffer 16, got %v with capacity %d", v.Buffered, cap(v.Buffered))
+	}
+}
+
+type TypeWithNonPrivateChannel struct {
+	Events chan int `inject:""`
+}
+
+func TestInjectNonPrivateChannel(t *testing.T) {
+	var v TypeWithNonPrivateChannel
+	err := inject.Populate(&v)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "inject on channel field Events in type *inject_test.TypeWithNonPrivateChannel must be private"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithReceiveOnlyChannel struct {
+	Events <-chan int `inject:"private"`
+}
+
+func TestInjectReceiveOnlyChannel(t *testing.T) {
+	var v TypeWithReceiveOnlyChannel
+	err := inject.Populate(&v)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "inject on channel field Events in type *inject_test.TypeWithReceiveOnlyChannel requires a bidirectional channel, not <-chan int"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithBufferOnPointer struct {
+	A *TypeAnswerStruct `inject:"private,buf=4"`
+}
+
+func TestInjectBufferOnNonChannel(t *testing.T) {
+	var v TypeWithBufferOnPointer
+	err := inject.Populate(&v)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "buffer size given for non channel field A (*inject_test.TypeAnswerStruct) in type *inject_test.TypeWithBufferOnPointer"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithInvalidBuffer struct {
+	Events chan int `inject:"private,buf=-1"`
+}
+
+func TestInjectInvalidBuffer(t *testing.T) {
+	var v TypeWithInvalidBuffer
+	err := inject.Populate(&v)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+
+	const msg = "unexpected tag format `inject:\"private,buf=-1\"` for field Events in type *inject_test.TypeWithInvalidBuffer"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeConstructed struct {
+	Ready bool
+}
+
+type TypeWithConstructed struct {
+	Shared  *TypeConstructed `inject:""`
+	Private *TypeConstructed `inject:"private"`
+}
+
+func TestConstructors(t *testing.T) {
+	calls := 0
+	g := inject.Graph{
+		Constructors: map[reflect.Type]func() interface{}{
+			reflect.TypeOf(&TypeConstructed{}): func() interface{} {
+				calls++
+				return &TypeConstructed{Ready: true}
+			},
+		},
+	}
+	var v TypeWithConstructed
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Shared.Ready || !v.Private.Ready {
+		t.Fatal("expected the dependencies to be built by their constructor")
+	}
+	if calls != 2 {
+		t.Fatalf("expected the constructor to be called twice, got %d", calls)
+	}
+}
+
+func TestConstructorReturningWrongType(t *testing.T) {
+	g := inject.Graph{
+		Constructors: map[reflect.Type]func() interface{}{
+			reflect.TypeOf(&TypeConstructed{}): func() interface{} { return &TypeAnswerStruct{} },
+		},
+	}
+	var v TypeWithConstructed
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "constructor for *inject_test.TypeConstructed returned &inject_test.TypeAnswerStruct{answer:0, private:0} instead of a non nil *inject_test.TypeConstructed for field Shared in type *inject_test.TypeWithConstructed"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeForDeterminismLeaf struct {
+	N int
+}
+
+type TypeForDeterminism struct {
+	Leaf    *TypeForDeterminismLeaf `inject:""`
+	Private *TypeForDeterminismLeaf `inject:"private"`
+}
+
+func TestPopulateIsDeterministic(t *testing.T) {
+	populate := func() []string {
+		l := &leveledLogger{}
+		g := inject.Graph{Logger: l}
+		for _, name := range []string{"e", "b", "d", "a", "c"} {
+			if err := g.Provide(&inject.Object{Value: &TypeForDeterminism{}, Name: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := g.Populate(); err != nil {
+			t.Fatal(err)
+		}
+		return l.messages
+	}
+
+	expected := populate()
+	if !strings.Contains(strings.Join(expected, "\n"), "assigned newly created *inject_test.TypeForDeterminismLeaf to field Leaf in *inject_test.TypeForDeterminism named a") {
+		t.Fatalf("expected the object named a to be populated first, got %v", expected)
+	}
+	for i := 0; i < 50; i++ {
+		if actual := populate(); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected:\n%v\nactual:\n%v", expected, actual)
+		}
+	}
+}
+
+func TestWarnOnSkip(t *testing.T) {
+	l := &leveledLogger{}
+	g := inject.Graph{Logger: l, WarnOnSkip: true}
+	preset := &TypeAnswerStruct{}
+	v := &TypeNestedStruct{A: preset}
+	if err := g.Provide(&inject.Object{Value: v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.A != preset {
+		t.Fatal("expected the preset value to be kept")
+	}
+	const msg = "info: skipping inject on field A in *inject_test.TypeNestedStruct because it is already set"
+	if !strings.Contains(strings.Join(l.messages, "\n"), msg) {
+		t.Fatalf("expected %q to be logged, got %v", msg, l.messages)
+	}
+}
+
+type TypeWithHandlerArray struct {
+	Handlers [2]TypeHandler `inject:""`
+}
+
+func TestInjectArray(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithHandlerArray
+	a := &TypeHandlerImpl{name: "a"}
+	b := &TypeResolvedHandler{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: b},
+		&inject.Object{Value: a, Name: "a"},
+		&inject.Object{Value: &TypeMemoryStore{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [2]TypeHandler{b, a}
+	if v.Handlers != expected {
+		t.Fatalf("expected %v, got %v", expected, v.Handlers)
+	}
+}
+
+func TestInjectArrayWithTooFewProviders(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithHandlerArray
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeHandlerImpl{name: "a"}, Name: "a"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "found 1 assignable values for array field Handlers ([2]inject_test.TypeHandler) in type *inject_test.TypeWithHandlerArray"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestSkip(t *testing.T) {
+	g := inject.Graph{
+		Skip: func(o *inject.Object) bool { return o.Name == "skipped" },
+	}
+	skipped := &TypeNestedStruct{}
+	wired := &TypeNestedStruct{}
+	err := g.Provide(
+		&inject.Object{Value: skipped, Name: "skipped"},
+		&inject.Object{Value: wired, Name: "wired"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if skipped.A != nil {
+		t.Fatal("expected the skipped object to be left alone")
+	}
+	if wired.A == nil {
+		t.Fatal("expected the other object to be wired")
+	}
+}
+
+type TypeWithNamedTypo struct {
+	Repo *TypeAnswerStruct `inject:"usrRepo"`
+}
+
+func TestNamedTypoSuggestion(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeWithNamedTypo{}},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "userRepo"},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "orderRepo"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = `did not find object named usrRepo required by field Repo in type *inject_test.TypeWithNamedTypo (did you mean "userRepo"?)`
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestNamedTypoWithoutCloseMatch(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeWithNamedTypo{}},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "orders"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "did not find object named usrRepo required by field Repo in type *inject_test.TypeWithNamedTypo"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithNamedStores struct {
+	Primary   TypeStore `inject:"redis"`
+	Secondary TypeStore `inject:"memory"`
+}
+
+func TestInjectNamedInterfaces(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithNamedStores
+	redis := &TypeRedisStore{}
+	memory := &TypeMemoryStore{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: redis, Name: "redis"},
+		&inject.Object{Value: memory, Name: "memory"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Primary != redis || v.Secondary != memory {
+		t.Fatal("expected each field to receive the store with its name")
+	}
+}
+
+func TestInjectNamedInterfaceMismatch(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithNamedStores
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "redis"},
+		&inject.Object{Value: &TypeMemoryStore{}, Name: "memory"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "object named redis of type *inject_test.TypeAnswerStruct is not assignable to field Primary (inject_test.TypeStore) in type *inject_test.TypeWithNamedStores"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeForPlan struct {
+	Existing *TypeForWalkLeaf   `inject:""`
+	Named    *TypeAnswerStruct  `inject:"answer"`
+	Created  *TypeForWalkMiddle `inject:""`
+	Private  *TypeOptionalLeaf  `inject:"private"`
+	Store    TypeStore          `inject:""`
+	Missing  *TypeAnswerStruct  `inject:"missing"`
+}
+
+func TestPlan(t *testing.T) {
+	var g inject.Graph
+	v := &TypeForPlan{}
+	err := g.Provide(
+		&inject.Object{Value: v},
+		&inject.Object{Value: &TypeForWalkLeaf{}},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "answer"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := g.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, e := range entries {
+		actual = append(actual, fmt.Sprintf("%s.%s %s %v", e.Type, e.Field, e.Action, e.Dependency))
+	}
+	expected := []string{
+		"*inject_test.TypeForPlan.Existing existing *inject_test.TypeForWalkLeaf",
+		"*inject_test.TypeForPlan.Named existing *inject_test.TypeAnswerStruct",
+		"*inject_test.TypeForPlan.Created create *inject_test.TypeForWalkMiddle",
+		"*inject_test.TypeForPlan.Private create *inject_test.TypeOptionalLeaf",
+		"*inject_test.TypeForPlan.Store unresolved <nil>",
+		"*inject_test.TypeForPlan.Missing unresolved <nil>",
+		"*inject_test.TypeForWalkMiddle.Leaf existing *inject_test.TypeForWalkLeaf",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected:\n%s\nactual:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	if v.Existing != nil || v.Created != nil || len(g.Objects()) != 3 {
+		t.Fatal("expected the plan to leave the graph untouched")
+	}
+}
+
+func TestPlanNamedAndUnnamedInterface(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(
+		&inject.Object{Value: &TypeWithStore{}},
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: &TypeRedisStore{}, Name: "redis"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := g.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Field != "Store" || entries[0].Action != inject.PlanUnresolved {
+		t.Fatalf("expected the ambiguous field to be unresolved, got %+v", entries)
+	}
+}
+
+type TypeWithStoreByType struct {
+	Store TypeStore `inject:"*inject_test.TypeRedisStore"`
+}
+
+func TestInjectInterfaceByTypeName(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStoreByType
+	redis := &TypeRedisStore{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}},
+		&inject.Object{Value: redis},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != redis {
+		t.Fatalf("expected the redis store, got %T", v.Store)
+	}
+}
+
+func TestInjectInterfaceByUnknownTypeName(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithStoreByType
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "did not find object of type *inject_test.TypeRedisStore required by field Store in type *inject_test.TypeWithStoreByType"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithOptionalStoreByType struct {
+	Store TypeStore `inject:"*inject_test.TypeRedisStore,optional"`
+}
+
+func TestInjectInterfaceByUnknownTypeNameOptional(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithOptionalStoreByType
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != nil {
+		t.Fatalf("expected the optional field to be left nil, got %T", v.Store)
+	}
+}
+
+type TypeWithDottedStoreName struct {
+	Store TypeStore `inject:"db.primry"`
+}
+
+func TestInjectInterfaceByMisspelledDottedName(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithDottedStoreName
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeMemoryStore{}, Name: "db.primary"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = `did not find object named db.primry required by field Store in type *inject_test.TypeWithDottedStoreName (did you mean "db.primary"?)`
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithOptionalDottedStoreName struct {
+	Store TypeStore `inject:"db.replica,optional"`
+}
+
+func TestInjectInterfaceByMissingDottedNameOptional(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithOptionalDottedStoreName
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Store != nil {
+		t.Fatalf("expected the optional field to be left nil, got %T", v.Store)
+	}
+}
+
+type TypePooledLeaf struct {
+	N int
+}
+
+type TypeWithPooled struct {
+	Leaf *TypePooledLeaf `inject:"private"`
+}
+
+func TestReleaseResetsPooledObject(t *testing.T) {
+	g := inject.Graph{UsePool: true}
+	root := &inject.Object{Value: &TypeWithPooled{}}
+	if err := g.Provide(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := root.Value.(*TypeWithPooled).Leaf
+	leaf.N = 42
+	if err := g.Release(root.Fields["Leaf"]); err != nil {
+		t.Fatal(err)
+	}
+	if leaf.N != 0 {
+		t.Fatalf("expected the released object to be reset, got %d", leaf.N)
+	}
+	for _, o := range g.Objects() {
+		if o.Value == leaf {
+			t.Fatal("expected the released object to be removed from the graph")
+		}
+	}
+
+	// Whether or not the pool hands the same value back, it must be zero.
+	var v TypeWithPooled
+	if err := g.Provide(&inject.Object{Value: &v, Name: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Leaf == nil || v.Leaf.N != 0 {
+		t.Fatalf("expected a zero pooled dependency, got %#v", v.Leaf)
+	}
+}
+
+func TestReleaseSharedObject(t *testing.T) {
+	g := inject.Graph{UsePool: true}
+	leaf := &inject.Object{Value: &TypePooledLeaf{}}
+	if err := g.Provide(leaf); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Release(leaf)
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "cannot release *inject_test.TypePooledLeaf because it was not created as a private object"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func benchmarkPopulatePrivate(b *testing.B, usePool bool) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		g := inject.Graph{UsePool: usePool}
+		root := &inject.Object{Value: &TypeWithPooled{}}
+		if err := g.Provide(root); err != nil {
+			b.Fatal(err)
+		}
+		if err := g.Populate(); err != nil {
+			b.Fatal(err)
+		}
+		if err := g.Release(root.Fields["Leaf"]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPopulatePrivate(b *testing.B) {
+	benchmarkPopulatePrivate(b, false)
+}
+
+func BenchmarkPopulatePrivatePooled(b *testing.B) {
+	benchmarkPopulatePrivate(b, true)
+}
+
+type TypeRepo struct {
+	N int
+}
+
+type TypeWithRepoFields struct {
+	UserRepo  *TypeRepo `inject:""`
+	OrderRepo *TypeRepo `inject:""`
+}
+
+func TestInjectByFieldName(t *testing.T) {
+	g := inject.Graph{NameByField: true}
+	var v TypeWithRepoFields
+	users := &TypeRepo{N: 1}
+	shared := &TypeRepo{N: 2}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: users, Name: "UserRepo"},
+		&inject.Object{Value: shared},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.UserRepo != users {
+		t.Fatal("expected the object named after the field")
+	}
+	if v.OrderRepo != shared {
+		t.Fatal("expected the unnamed object for a field without a named match")
+	}
+}
+
+func TestInjectByFieldNameDisabled(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithRepoFields
+	shared := &TypeRepo{}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeRepo{}, Name: "UserRepo"},
+		&inject.Object{Value: shared},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.UserRepo != shared || v.OrderRepo != shared {
+		t.Fatal("expected fields to be resolved by type")
+	}
+}
+
+func TestInjectByFieldNameWrongType(t *testing.T) {
+	g := inject.Graph{NameByField: true}
+	var v TypeWithRepoFields
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeAnswerStruct{}, Name: "UserRepo"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.UserRepo == nil || v.UserRepo != v.OrderRepo {
+		t.Fatal("expected a mistyped name match to fall back to type resolution")
+	}
+}
+
+type TypeLegacyLogger struct {
+	Prefix string
+}
+
+type TypeLogWriter interface {
+	Write(msg string) string
+}
+
+type TypeLegacyLoggerAdapter struct {
+	legacy *TypeLegacyLogger
+}
+
+func (a *TypeLegacyLoggerAdapter) Write(msg string) string {
+	return a.legacy.Prefix + msg
+}
+
+type TypeWithLogWriter struct {
+	Writer TypeLogWriter `inject:""`
+	Named  TypeLogWriter `inject:"legacy"`
+}
+
+func legacyLoggerAdapter(from, to reflect.Type) (func(interface{}) interface{}, bool) {
+	if from != reflect.TypeOf(&TypeLegacyLogger{}) || to != reflect.TypeOf((*TypeLogWriter)(nil)).Elem() {
+		return nil, false
+	}
+	return func(v interface{}) interface{} {
+		return &TypeLegacyLoggerAdapter{legacy: v.(*TypeLegacyLogger)}
+	}, true
+}
+
+func TestAdapters(t *testing.T) {
+	g := inject.Graph{
+		Adapters: []func(from, to reflect.Type) (func(interface{}) interface{}, bool){
+			legacyLoggerAdapter,
+		},
+	}
+	var v TypeWithLogWriter
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeLegacyLogger{Prefix: "unnamed: "}},
+		&inject.Object{Value: &TypeLegacyLogger{Prefix: "named: "}, Name: "legacy"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := v.Writer.Write("hi"); got != "unnamed: hi" {
+		t.Fatalf("expected the adapted unnamed logger, got %q", got)
+	}
+	if got := v.Named.Write("hi"); got != "named: hi" {
+		t.Fatalf("expected the adapted named logger, got %q", got)
+	}
+}
+
+func TestAdapterReturningWrongType(t *testing.T) {
+	g := inject.Graph{
+		Adapters: []func(from, to reflect.Type) (func(interface{}) interface{}, bool){
+			func(from, to reflect.Type) (func(interface{}) interface{}, bool) {
+				return func(v interface{}) interface{} { return v }, true
+			},
+		},
+	}
+	var v TypeWithLogWriter
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		&inject.Object{Value: &TypeLegacyLogger{}, Name: "legacy"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "adapter from *inject_test.TypeLegacyLogger returned &inject_test.TypeLegacyLogger{Prefix:\"\"} which is not assignable to field Named (inject_test.TypeLogWriter) in type *inject_test.TypeWithLogWriter"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWithOwnerName struct {
+	Owner string `inject:""`
+}
+
+func TestObjectResolver(t *testing.T) {
+	g := inject.Graph{
+		ObjectResolvers: []func(*inject.Object, reflect.StructField, reflect.Type) (reflect.Value, bool, error){
+			func(o *inject.Object, field reflect.StructField, fieldType reflect.Type) (reflect.Value, bool, error) {
+				if field.Name != "Owner" {
+					return reflect.Value{}, false, nil
+				}
+				return reflect.ValueOf(o.Name), true, nil
+			},
+		},
+	}
+	a, b := &TypeWithOwnerName{}, &TypeWithOwnerName{}
+	err := g.Provide(
+		&inject.Object{Value: a, Name: "a"},
+		&inject.Object{Value: b, Name: "b"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if a.Owner != "a" || b.Owner != "b" {
+		t.Fatalf("expected each object's own name, got %q and %q", a.Owner, b.Owner)
+	}
+}
+
+type TypeWithRepoNamed struct {
+	Repo *TypeRepo `inject:"repo"`
+}
+
+func TestProvidePlaceholder(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithRepoNamed
+	placeholder := &inject.Object{Name: "repo", DeclaredType: reflect.TypeOf(&TypeRepo{})}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		placeholder,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Repo != nil {
+		t.Fatal("expected the placeholder to be injected as nil")
+	}
+
+	repo := &TypeRepo{N: 1}
+	if err := g.Replace(placeholder, repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Repo != repo {
+		t.Fatal("expected the replacement to be injected")
+	}
+}
+
+func TestProvidePlaceholderNotPointer(t *testing.T) {
+	var g inject.Graph
+	err := g.Provide(&inject.Object{Name: "n", DeclaredType: reflect.TypeOf(0)})
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "declared type int of nil object named n is not a pointer"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestReplaceWithWrongType(t *testing.T) {
+	var g inject.Graph
+	placeholder := &inject.Object{Name: "repo", DeclaredType: reflect.TypeOf(&TypeRepo{})}
+	if err := g.Provide(placeholder); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Replace(placeholder, &TypeAnswerStruct{})
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "cannot replace *inject_test.TypeRepo named repo with &inject_test.TypeAnswerStruct{answer:0, private:0}"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestObjectKeysAreStable(t *testing.T) {
+	keys := func() []string {
+		var g inject.Graph
+		err := g.Provide(
+			&inject.Object{Value: &TypeForWalkRoot{}, Name: "root"},
+			&inject.Object{Value: &TypeForExport{}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Populate(); err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []string
+		for _, o := range g.Objects() {
+			keys = append(keys, o.Key())
+			for field, dep := range o.Fields {
+				keys = append(keys, o.Key()+"."+field+" -> "+dep.Key())
+			}
+		}
+		return keys
+	}
+
+	first := keys()
+	sameElements(t, keys(), first)
+	if !strings.Contains(strings.Join(first, "\n"), "*inject_test.TypeForWalkLeaf#2") {
+		t.Fatalf("expected a numbered key for the second object of a type, got %v", first)
+	}
+}
+
+func TestReplaceResetsDependents(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithRepoNamed
+	old := &inject.Object{Value: &TypeRepo{N: 1}, Name: "repo"}
+	err := g.Provide(
+		&inject.Object{Value: &v},
+		old,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &TypeRepo{N: 2}
+	if err := g.Replace(old, repo); err != nil {
+		t.Fatal(err)
+	}
+	if v.Repo != nil {
+		t.Fatal("expected the dependent field to be reset")
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Repo != repo {
+		t.Fatal("expected the replacement to be injected")
+	}
+}
+
+type TypeSelfCreating struct {
+	Next *TypeSelfCreating `inject:"private"`
+}
+
+func TestMaxDepth(t *testing.T) {
+	g := inject.Graph{MaxDepth: 2}
+	if err := g.Provide(&inject.Object{Value: &TypeSelfCreating{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "creating an object for *inject_test.TypeSelfCreating.Next -> *inject_test.TypeSelfCreating.Next -> *inject_test.TypeSelfCreating.Next would exceed the maximum depth of 2"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+type TypeWide struct {
+	A *TypeAnswerStruct `inject:"private"`
+	B *TypeAnswerStruct `inject:"private"`
+	C *TypeAnswerStruct `inject:"private"`
+}
+
+func TestMaxObjects(t *testing.T) {
+	g := inject.Graph{MaxObjects: 3}
+	if err := g.Provide(&inject.Object{Value: &TypeWide{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "creating an object for *inject_test.TypeWide.C would exceed the maximum of 3 objects"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestLimitsNotReached(t *testing.T) {
+	g := inject.Graph{MaxObjects: 4, MaxDepth: 1}
+	var v TypeWide
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.A == nil || v.B == nil || v.C == nil {
+		t.Fatal("expected all fields to be created")
+	}
+}
+
+type TypeProvided struct {
+	Leaf *TypeRepo `inject:""`
+}
+
+type TypeWithEagerProvider struct {
+	Get func() *TypeProvided `inject:",eager"`
+}
+
+type TypeWithLazyProvider struct {
+	Get func() *TypeProvided `inject:",lazy"`
+}
+
+func hasObjectOfType(g *inject.Graph, t reflect.Type) bool {
+	for _, o := range g.Objects() {
+		if o.Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEagerProvider(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithEagerProvider
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasObjectOfType(&g, reflect.TypeOf(&TypeProvided{})) {
+		t.Fatal("expected the eager dependency to be created by populate")
+	}
+	provided := v.Get()
+	if provided == nil || provided.Leaf == nil {
+		t.Fatal("expected a populated dependency")
+	}
+	if v.Get() != provided {
+		t.Fatal("expected the provider to return the same dependency")
+	}
+}
+
+func TestLazyProvider(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithLazyProvider
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hasObjectOfType(&g, reflect.TypeOf(&TypeProvided{})) {
+		t.Fatal("expected the lazy dependency not to be created by populate")
+	}
+	provided := v.Get()
+	if provided == nil || provided.Leaf == nil {
+		t.Fatal("expected a populated dependency")
+	}
+	if !hasObjectOfType(&g, reflect.TypeOf(&TypeProvided{})) {
+		t.Fatal("expected the lazy dependency to be provided once called")
+	}
+	if v.Get() != provided {
+		t.Fatal("expected the provider to return the same dependency")
+	}
+}
+
+type TypeWithTwoLazyProviders struct {
+	Provided func() *TypeProvided `inject:",lazy"`
+	Repo     func() *TypeRepo     `inject:",lazy"`
+}
+
+func TestLazyProvidersConcurrently(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithTwoLazyProviders
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var provided *TypeProvided
+	var repo *TypeRepo
+	wg.Add(2)
+	go func() { defer wg.Done(); provided = v.Provided() }()
+	go func() { defer wg.Done(); repo = v.Repo() }()
+	wg.Wait()
+
+	if provided == nil || provided.Leaf == nil || repo == nil {
+		t.Fatal("expected both providers to return a populated dependency")
+	}
+	if provided.Leaf != repo {
+		t.Fatal("expected both providers to share the created dependency")
+	}
+}
+
+func TestLazyProviderLeavesGraphAlone(t *testing.T) {
+	var g inject.Graph
+	var v TypeWithLazyProvider
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	var late TypeProvided
+	if err := g.Provide(&inject.Object{Value: &late, Name: "late"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if provided := v.Get(); provided == nil || provided.Leaf == nil {
+		t.Fatal("expected a populated dependency")
+	}
+	if late.Leaf != nil {
+		t.Fatal("expected the lazy provider not to populate objects it did not create")
+	}
+}
+
+type TypeWithEagerPointer struct {
+	A *TypeAnswerStruct `inject:",eager"`
+}
+
+func TestEagerOnNonProvider(t *testing.T) {
+	var g inject.Graph
+	if err := g.Provide(&inject.Object{Value: &TypeWithEagerPointer{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := g.Populate()
+	if err == nil {
+		t.Fatal("did not find expected error")
+	}
+	const msg = "eager or lazy requested on non provider field A in type *inject_test.TypeWithEagerPointer"
+	if err.Error() != msg {
+		t.Fatalf("expected:\n%s\nactual:\n%s", msg, err.Error())
+	}
+}
+
+func TestResetCaches(t *testing.T) {
+	var g inject.Graph
+	var v TypeForDeterminism
+	if err := g.Provide(&inject.Object{Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.CanResolve(reflect.TypeOf(&TypeForDeterminism{})) {
+		t.Fatal("expected the provided object to resolve")
+	}
+
+	g.ResetCaches()
+	if err := g.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Leaf == nil || v.Private == nil {
+		t.Fatal("expected populate to work after resetting the caches")
+	}
+	if !g.CanResolve(reflect.TypeOf(&TypeForDeterminismLeaf{})) {
+		t.Fatal("expected the type index to be rebuilt")
+	}
+}
+
+type TypeForCacheBenchmark struct {
+	Leaf     *TypeForDeterminismLeaf `inject:""`
+	Answer   *TypeAnswerStruct       `inject:""`
+	Repo     *TypeRepo               `inject:""`
+	Untagged *TypeRepo
+}
+
+func benchmarkPopulateCaches(b *testing.B, cold bool) {
+	b.ReportAllocs()
+	var g inject.Graph
+	root := &TypeForCacheBenchmark{}
+	if err := g.Provide(&inject.Object{Value: root}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		// Clear the fields so that every round populates them again.
+		*root = TypeForCacheBenchmark{}
+		if cold {
+			g.ResetCaches()
+		}
+		if err := g.Populate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPopulateWarm(b *testing.B) {
+	benchmarkPopulateCaches(b, false)
+}
+
+func BenchmarkPopulateCold(b *testing.B) {
+	benchmarkPopulateCaches(b, true)
+}
@@ -0,0 +1,56 @@
+// Package injecttest provides helpers for asserting how a container wired its
+// services in tests.
+package injecttest
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tommynurwantoro/gontainer"
+)
+
+// AssertWired reports an error if a field of the service registered as id
+// that carries an inject tag is still nil or zero. Optional fields are not
+// checked. It is meant to be called after the container is ready.
+func AssertWired(t testing.TB, c gontainer.Container, id string) {
+	t.Helper()
+
+	svc := c.GetServiceOrNil(id)
+	v := reflect.ValueOf(svc)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		t.Errorf("service %s of type %T is not a pointer to a struct", id, svc)
+		return
+	}
+
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, ok := field.Tag.Lookup("inject")
+		if !ok || slices.Contains(strings.Split(tag, ","), "optional") {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			t.Errorf("field %s of service %s was not injected", field.Name, id)
+		}
+	}
+}
+
+// AssertDependsOn reports an error if the service registered as id doesn't
+// depend on dep, which is the id of a named dependency or the type of an
+// unnamed one as reported by Container.Describe.
+func AssertDependsOn(t testing.TB, c gontainer.Container, id, dep string) {
+	t.Helper()
+
+	for _, info := range c.Describe() {
+		if info.ID != id {
+			continue
+		}
+		if !slices.Contains(info.Dependencies, dep) {
+			t.Errorf("service %s does not depend on %s, its dependencies are %v", id, dep, info.Dependencies)
+		}
+		return
+	}
+	t.Errorf("service %s not found", id)
+}
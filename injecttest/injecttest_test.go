@@ -0,0 +1,85 @@
+package injecttest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tommynurwantoro/gontainer"
+	"github.com/tommynurwantoro/gontainer/injecttest"
+)
+
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+type TypeDependency struct{}
+
+type TypeService struct {
+	Dep     *TypeDependency `inject:""`
+	Named   *TypeDependency `inject:"named"`
+	Missing *TypeDependency `inject:",optional"`
+}
+
+func newContainer(t *testing.T) gontainer.Container {
+	c := gontainer.New()
+	c.RegisterService("named", &TypeDependency{})
+	c.RegisterService("svc", &TypeService{})
+	if err := c.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAssertWired(t *testing.T) {
+	tb := &recordingTB{}
+	injecttest.AssertWired(tb, newContainer(t), "svc")
+	if len(tb.errors) != 0 {
+		t.Fatalf("expected no errors, got %v", tb.errors)
+	}
+}
+
+func TestAssertWiredFails(t *testing.T) {
+	c := gontainer.New()
+	c.RegisterService("svc", &TypeService{})
+
+	tb := &recordingTB{}
+	injecttest.AssertWired(tb, c, "svc")
+	expected := []string{
+		"field Dep of service svc was not injected",
+		"field Named of service svc was not injected",
+	}
+	if fmt.Sprint(tb.errors) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, tb.errors)
+	}
+}
+
+func TestAssertDependsOn(t *testing.T) {
+	c := newContainer(t)
+	tb := &recordingTB{}
+	injecttest.AssertDependsOn(tb, c, "svc", "named")
+	injecttest.AssertDependsOn(tb, c, "svc", "*injecttest_test.TypeDependency")
+	if len(tb.errors) != 0 {
+		t.Fatalf("expected no errors, got %v", tb.errors)
+	}
+}
+
+func TestAssertDependsOnFails(t *testing.T) {
+	c := newContainer(t)
+	tb := &recordingTB{}
+	injecttest.AssertDependsOn(tb, c, "svc", "other")
+	injecttest.AssertDependsOn(tb, c, "missing", "named")
+	expected := []string{
+		"service svc does not depend on other, its dependencies are [*injecttest_test.TypeDependency named]",
+		"service missing not found",
+	}
+	if fmt.Sprint(tb.errors) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, tb.errors)
+	}
+}